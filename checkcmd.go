@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gofeed check, evaluate Feed.Tests of the targets offline
+func RunCheckCommand(args []string) (ok bool) {
+	cmd := flag.NewFlagSet(CMD_CHECK, flag.ExitOnError)
+	targetName := cmd.String("t", "", "Feed.Title or Feed.Path of the target to check, default is all the targets")
+	cmd.Usage = func() {
+		fmt.Printf("Usage %s check [-t target] json_config_file\n\n", os.Args[0])
+		fmt.Printf("Flags:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if 1 != cmd.NArg() {
+		cmd.Usage()
+		return false
+	}
+	conf, err := LoadJsonConfig(cmd.Arg(0))
+	if nil != err {
+		log.Printf("[ERROR] %s: %s", cmd.Arg(0), err)
+		return false
+	}
+	var selected *TargetConfig
+	if "" != *targetName {
+		if selected = FindTargetConfig(conf, *targetName); nil == selected {
+			log.Printf("[ERROR] feed target %s not found in %s", *targetName, cmd.Arg(0))
+			return false
+		}
+	}
+
+	// fixture files are relative to the config file
+	baseDir := filepath.Dir(cmd.Arg(0))
+	ok = true
+	checkNum, failedNum := 0, 0
+	for ind := range conf.Targets {
+		tar := &conf.Targets[ind]
+		if nil != selected && selected != tar {
+			continue
+		}
+		if 0 == len(tar.Tests) {
+			if nil != selected {
+				log.Printf("[WARN] feed target %s has no Feed.Tests", TargetName(tar))
+			}
+			continue
+		}
+
+		fmt.Printf("feed target %s\n", TargetName(tar))
+		feedTar, err := BuildFeedTarget(conf, tar)
+		if nil != err {
+			fmt.Printf("FAILED: %s\n\n", err)
+			ok = false
+			continue
+		}
+		steps := CheckFixtures(feedTar, tar.Tests, baseDir)
+		PrintTestSteps(os.Stdout, steps)
+		fmt.Println()
+		for _, step := range steps {
+			checkNum += 1
+			if step.Failed {
+				failedNum += 1
+				ok = false
+			}
+		}
+	}
+
+	if 0 == checkNum {
+		log.Printf("[ERROR] no Feed.Tests found in %s", cmd.Arg(0))
+		return false
+	}
+	fmt.Printf("%d checks, %d failed\n", checkNum, failedNum)
+	return
+}
+
+// extract the sample pages of fixtures with the extractors of feedTar, and compare the results
+// with the expected ones. Pages not in Feed.URL share the patterns of the first Feed.URL.
+func CheckFixtures(feedTar *FeedTarget, fixtures []FixtureConfig, baseDir string) (steps []TestStep) {
+	if nil == feedTar.IndexPageOrigins {
+		feedTar.IndexPageOrigins = make(map[*url.URL]*url.URL)
+	}
+
+	for ind, fixture := range fixtures {
+		key := PatternKey("Feed.Tests", ind)
+		addStep := func(step, page string, failed bool, format string, args ...interface{}) {
+			steps = append(steps, TestStep{Step: step, Key: key, Page: page, Result: fmt.Sprintf(format, args...), Failed: failed})
+		}
+
+		if "" == fixture.IndexFile && "" == fixture.ContentFile {
+			addStep("fixture", "", true, "IndexFile or ContentFile should be defined")
+			continue
+		}
+		if ("" == fixture.IndexFile && (0 != len(fixture.Titles) || 0 != len(fixture.Links))) ||
+			("" == fixture.ContentFile && "" != fixture.Description) {
+			addStep("fixture", "", true, "Titles and Links are checked with IndexFile, Description is checked with ContentFile")
+			continue
+		}
+
+		pageURL := feedTar.URLs[0]
+		if "" != fixture.URL {
+			fixtureURL, err := url.Parse(NormalizeURLStr(fixture.URL))
+			if nil != err {
+				addStep("fixture", "", true, "invalid URL %s: %s", fixture.URL, err)
+				continue
+			}
+			pageURL = fixtureURL
+			for _, tarURL := range feedTar.URLs {
+				if tarURL.String() == fixtureURL.String() {
+					pageURL = tarURL
+				}
+			}
+			if pageURL == fixtureURL {
+				feedTar.IndexPageOrigins[pageURL] = feedTar.URLs[0]
+			}
+		}
+		feed := &Feed{Title: feedTar.Title, URL: FindTargetURL(feedTar, pageURL)}
+
+		entry := &FeedEntry{Link: pageURL}
+		if indexRegs := FindIndexRegs(feedTar, pageURL); 0 != len(indexRegs) {
+			entry.IndexPattern = indexRegs[0]
+		}
+		if "" != fixture.IndexFile {
+			rawData, err := ReadTestPage(feedTar, pageURL, FixturePath(baseDir, fixture.IndexFile))
+			if nil != err {
+				addStep("index", fixture.IndexFile, true, "%s", err)
+				continue
+			}
+			entries, err := feedTar.IndexExtractor.ExtractIndex(feed, pageURL, IndexExtractorData(feedTar, rawData, MinifyHtml(RemoveJunkContent(rawData))))
+			if nil != err {
+				addStep("index", fixture.IndexFile, true, "%s", err)
+				continue
+			}
+			if result, ok := CompareFixtureEntries(fixture, pageURL, entries); ok {
+				addStep("index", fixture.IndexFile, false, "%s", result)
+			} else {
+				addStep("index", fixture.IndexFile, true, "%s", result)
+			}
+			if 0 != len(entries) {
+				entry = entries[0]
+				// xpath and css selector rules keep the entries without link
+				if nil == entry.Link {
+					entry.Link = pageURL
+				}
+			}
+		}
+
+		if "" != fixture.ContentFile {
+			htmlData, err := LoadTestPage(feedTar, pageURL, FixturePath(baseDir, fixture.ContentFile))
+			if nil != err {
+				addStep("content", fixture.ContentFile, true, "%s", err)
+				continue
+			}
+			fields, err := feedTar.ContentExtractor.ExtractContent(feed, entry, htmlData)
+			if nil != err {
+				addStep("content", fixture.ContentFile, true, "%s", err)
+				continue
+			}
+			content := strings.TrimSpace(string(fields[PATTERN_CONTENT]))
+			if !strings.HasPrefix(content, fixture.Description) {
+				addStep("content", fixture.ContentFile, true, "expected description %q, got %q", fixture.Description,
+					TruncateString(content, len([]rune(fixture.Description))+TEST_COLUMN_WIDTH))
+			} else {
+				addStep("content", fixture.ContentFile, false, "%d bytes", len(content))
+			}
+		}
+	}
+
+	return
+}
+
+func FixturePath(baseDir, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(baseDir, file)
+}
+
+// compare entries with the expected titles and links of fixture, relative links are resolved
+// against pageURL. Only the number of entries is checked if neither is defined.
+func CompareFixtureEntries(fixture FixtureConfig, pageURL *url.URL, entries []*FeedEntry) (result string, ok bool) {
+	for _, expected := range [][]string{fixture.Titles, fixture.Links} {
+		if 0 != len(expected) && len(expected) != len(entries) {
+			return fmt.Sprintf("expected %d entries, got %d", len(expected), len(entries)), false
+		}
+	}
+
+	for ind, entry := range entries {
+		if ind < len(fixture.Titles) {
+			title := strings.TrimSpace(html.UnescapeString(entry.Title))
+			if fixture.Titles[ind] != title {
+				return fmt.Sprintf("entry %d: expected title %q, got %q", ind+1, fixture.Titles[ind], title), false
+			}
+		}
+		if ind < len(fixture.Links) {
+			link, err := pageURL.Parse(fixture.Links[ind])
+			if nil != err {
+				return fmt.Sprintf("entry %d: invalid link %s: %s", ind+1, fixture.Links[ind], err), false
+			}
+			if nil == entry.Link || link.String() != entry.Link.String() {
+				return fmt.Sprintf("entry %d: expected link %s, got %v", ind+1, link.String(), entry.Link), false
+			}
+		}
+	}
+
+	return fmt.Sprintf("%d entries", len(entries)), true
+}
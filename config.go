@@ -2,133 +2,327 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // exits on any parse or check error
 func ParseJsonConfig(path string) (feedTargets []*FeedTarget) {
-	var conf Config
-	if configData, err := ioutil.ReadFile(path); nil != err {
+	conf, err := LoadJsonConfig(path)
+	if nil != err {
 		log.Fatalf("%s: %s", path, err)
-	} else {
-		err = json.Unmarshal(configData, &conf)
+	}
+
+	feedTargets = make([]*FeedTarget, len(conf.Targets))
+
+	// check target settings
+	for i := 0; i < len(conf.Targets); i++ {
+		tar := &conf.Targets[i]
+
+		// Feed.Path and Feed.Format define the first output
+		outConfs := tar.Outputs
+		if "" != tar.FeedPath {
+			outConfs = append([]OutputConfig{OutputConfig{Path: tar.FeedPath, Format: tar.FeedFormat}}, outConfs...)
+		}
+		if 0 == len(outConfs) {
+			log.Fatalf("no output for feed target %s, Feed.Path or Feed.Outputs should be defined", tar.Title)
+		}
+
+		if !LogPatternIssues(LintContentRules(tar)) {
+			log.Fatalf("failed to parse feed target %s: no content rule", TargetName(tar))
+		}
+		feedTar, err := BuildFeedTarget(conf, tar)
 		if nil != err {
-			log.Fatalf("%s: %s", path, err)
+			log.Fatalf("failed to parse feed target %s: %s", TargetName(tar), err)
 		}
-		if 0 == len(conf.Targets) {
-			log.Fatalf("[ERROR] no targets in config file %s", path)
+
+		outPaths := make(map[string]bool)
+		for _, outConf := range outConfs {
+			output := ParseFeedOutput(outConf)
+			if outPaths[output.Path] {
+				log.Fatalf("duplicate output path %s of feed target %s", output.Path, tar.Title)
+			}
+			outPaths[output.Path] = true
+			feedTar.Outputs = append(feedTar.Outputs, output)
 		}
+
+		feedTar.FeedPath = feedTar.Outputs[0].Path
+
+		// set feed title
+		if "" == feedTar.Title {
+			feedTar.Title = filepath.Base(feedTar.FeedPath)
+		}
+
+		// add feed target
+		feedTargets = append(feedTargets[:i], feedTar)
 	}
 
+	return
+}
+
+// read json configuration and check the global settings
+func LoadJsonConfig(path string) (conf *Config, err error) {
+	configData, err := ioutil.ReadFile(path)
+	if nil != err {
+		return
+	}
+	conf = new(Config)
+	if err = json.Unmarshal(configData, conf); nil != err {
+		return nil, err
+	}
+	if 0 == len(conf.Targets) {
+		return nil, errors.New("no targets in config file")
+	}
+
+	return conf, CheckConfig(conf)
+}
+
+// check the global settings, CacheDB defaults to DB_NAME in the working directory
+func CheckConfig(conf *Config) (err error) {
 	// parse cache lifetime
-	cacheLifeTime := ExtractCacheLifetime(conf.CacheLifetime)
-	if -2 == cacheLifeTime {
-		log.Fatalf("[ERROR] wrong cache lifetime %s in config file %s", conf.CacheLifetime, path)
+	if -2 == ExtractCacheLifetime(conf.CacheLifetime) {
+		return errors.New("wrong cache lifetime " + conf.CacheLifetime)
 	}
 
 	// check cache db
 	if "" == conf.CacheDB {
-		conf.CacheDB = "cache.db"
+		conf.CacheDB = DB_NAME
 	}
-	var err error
-	conf.CacheDB, err = filepath.Abs(conf.CacheDB)
+	absCacheDB, err := filepath.Abs(conf.CacheDB)
 	if nil != err {
-		log.Fatalf("failed to abs CacheDB %s", conf.CacheDB)
-		return
+		return fmt.Errorf("failed to abs CacheDB %s: %s", conf.CacheDB, err)
 	}
+	conf.CacheDB = absCacheDB
 
 	if conf.HttpTimeout < 0 {
-		log.Fatalf("wrong http timeout value: %f", conf.HttpTimeout)
-		return
+		return fmt.Errorf("wrong http timeout value: %d", conf.HttpTimeout)
 	}
 
-	feedTargets = make([]*FeedTarget, len(conf.Targets))
+	return
+}
 
-	// check target settings
-	for i := 0; i < len(conf.Targets); i++ {
-		tar := &conf.Targets[i]
-		feedTar := &FeedTarget{
-			CacheDB:       conf.CacheDB,
-			CacheLifetime: cacheLifeTime,
-			ReqInterval:   tar.ReqInterval,
-			Description:   tar.Description,
-			HttpTimeout:   time.Millisecond * time.Duration(conf.HttpTimeout),
-		}
+// target which only downloads and caches pages with the global settings, used by the sub commands
+func NewFetchTarget(conf *Config) *FeedTarget {
+	return &FeedTarget{
+		CacheDB:       conf.CacheDB,
+		CacheLifetime: ExtractCacheLifetime(conf.CacheLifetime),
+		HttpTimeout:   time.Millisecond * time.Duration(conf.HttpTimeout),
+	}
+}
 
-		// abs feed path
-		tar.FeedPath, err = filepath.Abs(tar.FeedPath)
-		if nil != err {
-			log.Fatalf("error abs feed path %s", tar.FeedPath)
-		}
-		// check feed existense
-		if feedFile, err := os.Stat(tar.FeedPath); nil == err {
-			if feedFile.IsDir() {
-				log.Fatalf("config error, feed path is a directory %s", tar.FeedPath)
-			} else {
-				log.Printf("[WARN] feed %s already exists, will overwrite it", tar.FeedPath)
-			}
+// check and compile the target settings except outputs
+func BuildFeedTarget(conf *Config, tar *TargetConfig) (feedTar *FeedTarget, err error) {
+	feedTar = &FeedTarget{
+		Title:         tar.Title,
+		CacheDB:       conf.CacheDB,
+		CacheLifetime: ExtractCacheLifetime(conf.CacheLifetime),
+		ReqInterval:   tar.ReqInterval,
+		Description:   tar.Description,
+		Metadata:      tar.Metadata,
+		HttpTimeout:   time.Millisecond * time.Duration(conf.HttpTimeout),
+	}
+
+	// check patterns, issues are printed by CheckPatterns
+	if !CheckPatterns(tar) {
+		return nil, errors.New("invalid patterns")
+	}
+
+	// compile patterns
+	if err = CompilePatterns(feedTar, tar); nil != err {
+		return nil, errors.New("failed to compile index/content patterns: " + err.Error())
+	}
+
+	// check index pagination
+	if 0 > tar.MaxPages {
+		return nil, fmt.Errorf("invalid Feed.MaxPages %d", tar.MaxPages)
+	}
+	feedTar.MaxPages = 1
+	if nil != feedTar.NextPageReg {
+		feedTar.MaxPages = tar.MaxPages
+		if 0 == feedTar.MaxPages {
+			feedTar.MaxPages = INDEX_MAX_PAGES
 		}
-		// check parent folder existense
-		absParentDir := filepath.Dir(tar.FeedPath)
-		feedParentDir, err := os.Stat(absParentDir)
-		if nil == err && !feedParentDir.IsDir() {
-			log.Fatalf("parent directory of feed %s is actually a FILE %s", tar.FeedPath, absParentDir)
+	}
+
+	// check content pagination
+	if 0 > tar.ContentMaxPages {
+		return nil, fmt.Errorf("invalid Feed.ContentMaxPages %d", tar.ContentMaxPages)
+	}
+	feedTar.ContentMaxPages = 1
+	if nil != feedTar.ContentNextPageReg {
+		feedTar.ContentMaxPages = tar.ContentMaxPages
+		if 0 == feedTar.ContentMaxPages {
+			feedTar.ContentMaxPages = CONTENT_MAX_PAGES
 		}
+	}
+
+	// create extractors of index and content html
+	if err = CreateExtractors(feedTar, tar); nil != err {
+		return nil, errors.New("failed to create extractors: " + err.Error())
+	}
+
+	// expand url templates, which may change the number of urls
+	if 0 == len(tar.URLs) {
+		return nil, errors.New("no urls")
+	}
+	if 0 > tar.URLLookback {
+		return nil, fmt.Errorf("invalid Feed.URLLookback %d", tar.URLLookback)
+	}
+	urls, urlInds, err := ExpandURLTemplates(tar, time.Now())
+	if nil != err {
+		return nil, errors.New("failed to expand url templates: " + err.Error())
+	}
+
+	// normalize url
+	feedTar.URLs = make([]*url.URL, len(urls))
+	feedTar.URLIndexes = make(map[*url.URL]int)
+	feedTar.URLNum = len(tar.URLs)
+	for urlInd, rawURL := range urls {
+		normalURL, err := url.Parse(NormalizeURLStr(rawURL))
 		if nil != err {
-			log.Printf("parent directory %s of feed %s does not exist, will create it", absParentDir, tar.FeedPath)
-			err = os.MkdirAll(absParentDir, 0755)
-			if nil != err {
-				log.Fatalf("failed to create directory %s for feed %s", absParentDir, tar.FeedPath)
-			}
+			return nil, fmt.Errorf("error parsing target url %s: %s", rawURL, err)
 		}
+		feedTar.URLs[urlInd] = normalURL
+		feedTar.URLIndexes[normalURL] = urlInds[urlInd]
+	}
 
-		feedTar.FeedPath = tar.FeedPath
+	return
+}
 
-		// set feed title
-		if "" != tar.Title {
-			feedTar.Title = tar.Title
+// exits on any check error
+func ParseFeedOutput(outConf OutputConfig) (output *FeedOutput) {
+	output = new(FeedOutput)
+	output.Gzip = outConf.Gzip
+
+	// check feed format
+	output.Format = strings.ToLower(strings.TrimSpace(outConf.Format))
+	switch output.Format {
+	case "":
+		output.Format = FEED_FORMAT_RSS
+	case FEED_FORMAT_RSS, FEED_FORMAT_ATOM, FEED_FORMAT_JSON:
+	default:
+		log.Fatalf("unknown feed format %s of feed %s, should be %s, %s or %s", outConf.Format, outConf.Path, FEED_FORMAT_RSS, FEED_FORMAT_ATOM, FEED_FORMAT_JSON)
+	}
+
+	// abs feed path
+	var err error
+	output.Path, err = filepath.Abs(outConf.Path)
+	if nil != err {
+		log.Fatalf("error abs feed path %s", outConf.Path)
+	}
+	// check feed existense
+	if feedFile, err := os.Stat(output.Path); nil == err {
+		if feedFile.IsDir() {
+			log.Fatalf("config error, feed path is a directory %s", output.Path)
 		} else {
-			feedTar.Title = filepath.Base(tar.FeedPath)
+			log.Printf("[WARN] feed %s already exists, will overwrite it", output.Path)
 		}
-
-		// check index/content patterns
-		if !CheckPatterns(tar) {
-			log.Fatal("error parsing configuration: empty index/content pattern")
+	}
+	// check parent folder existense
+	absParentDir := filepath.Dir(output.Path)
+	feedParentDir, err := os.Stat(absParentDir)
+	if nil == err && !feedParentDir.IsDir() {
+		log.Fatalf("parent directory of feed %s is actually a FILE %s", output.Path, absParentDir)
+	}
+	if nil != err {
+		log.Printf("parent directory %s of feed %s does not exist, will create it", absParentDir, output.Path)
+		err = os.MkdirAll(absParentDir, 0755)
+		if nil != err {
+			log.Fatalf("failed to create directory %s for feed %s", absParentDir, output.Path)
 		}
+	}
 
-		// check pubdate patterns
-		pubDateNum := len(tar.PubDatePatterns)
-		if 0 != pubDateNum && 1 != pubDateNum && len(tar.URLs) != pubDateNum {
-			log.Fatalf("failed to parse pubdate patterns, number of pubdate should be 0 or 1 or the same as Feed.URL")
-		}
+	return
+}
 
-		// compile patterns
-		err = CompilePatterns(feedTar, tar)
+// expand the url templates of Feed.URL, urlInds are the indexes of the Feed.URL which the urls
+// are expanded from. Patterns of a Feed.URL are shared by its expanded urls, see FindTargetURLIndex
+func ExpandURLTemplates(tar *TargetConfig, now time.Time) (urls []string, urlInds []int, err error) {
+	for urlInd, rawURL := range tar.URLs {
+		expandedURLs, err := ExpandURLTemplate(rawURL, tar.URLLookback, now)
 		if nil != err {
-			log.Fatalf("failed to compile index/content patterns for feed target %s: %s", feedTar.FeedPath, err)
+			return nil, nil, err
+		}
+		urls = append(urls, expandedURLs...)
+		for range expandedURLs {
+			urlInds = append(urlInds, urlInd)
+		}
+	}
+
+	if *gVerbose && len(urls) != len(tar.URLs) {
+		log.Printf("expanded %d urls to %d urls", len(tar.URLs), len(urls))
+	}
+	return
+}
+
+// expand {yyyy}, {mm} and {dd} with today and lookback days before today, and numeric
+// ranges like {1..5}, numbers are padded with zeros if the range starts with 0, such as {01..12}
+func ExpandURLTemplate(rawURL string, lookback int, now time.Time) (urls []string, err error) {
+	// date placeholders
+	dateURLs := []string{rawURL}
+	if strings.Contains(rawURL, URL_TEMPLATE_YEAR) || strings.Contains(rawURL, URL_TEMPLATE_MONTH) || strings.Contains(rawURL, URL_TEMPLATE_DAY) {
+		// one url for each day, which is checked before the numeric ranges multiply them
+		if URL_TEMPLATE_MAX_URLS < lookback+1 {
+			return nil, fmt.Errorf("too many urls expanded from url template %s, Feed.URLLookback should be less than %d", rawURL, URL_TEMPLATE_MAX_URLS)
 		}
+		dateURLs = nil
+		now = now.In(GOFEED_DEFAULT_TIMEZONE)
+		for i := 0; i <= lookback; i++ {
+			date := now.AddDate(0, 0, -i)
+			r := strings.NewReplacer(
+				URL_TEMPLATE_YEAR, date.Format("2006"),
+				URL_TEMPLATE_MONTH, date.Format("01"),
+				URL_TEMPLATE_DAY, date.Format("02"),
+			)
+			dateURLs = append(dateURLs, r.Replace(rawURL))
+		}
+	}
 
-		// normalize url
-		if 0 == len(tar.URLs) {
-			log.Fatalf("no urls for %s", tar.FeedPath)
+	// numeric ranges
+	for len(dateURLs) > 0 {
+		u := dateURLs[0]
+		dateURLs = dateURLs[1:]
+		match := URL_TEMPLATE_RANGE_REGEX.FindStringSubmatchIndex(u)
+		if nil == match {
+			urls = append(urls, u)
+			continue
 		}
-		feedTar.URLs = make([]*url.URL, len(tar.URLs))
-		for urlInd, rawURL := range tar.URLs {
-			normalURL, err := url.Parse(NormalizeURLStr(rawURL))
-			if nil != err {
-				log.Fatalf("error parsing target url %s: %s", rawURL, err)
-			}
-			feedTar.URLs[urlInd] = normalURL
+		start, _ := strconv.Atoi(u[match[2]:match[3]])
+		end, _ := strconv.Atoi(u[match[4]:match[5]])
+		width := 0
+		if strings.HasPrefix(u[match[2]:match[3]], "0") {
+			width = match[3] - match[2]
+		}
+		if end < start || URL_TEMPLATE_MAX_URLS < end-start+1 {
+			return nil, errors.New("invalid range in url template " + rawURL)
+		}
+		var rangeURLs []string
+		for n := start; n <= end; n++ {
+			rangeURLs = append(rangeURLs, u[:match[0]]+fmt.Sprintf("%0*d", width, n)+u[match[1]:])
 		}
+		dateURLs = append(rangeURLs, dateURLs...)
+		if URL_TEMPLATE_MAX_URLS < len(dateURLs)+len(urls) {
+			return nil, errors.New("too many urls expanded from url template " + rawURL)
+		}
+	}
 
-		// add feed target
-		feedTargets = append(feedTargets[:i], feedTar)
+	// remove duplicate urls, {yyyy}/{mm} expands to the same url for days in the same month
+	urlMap := make(map[string]bool)
+	uniqueURLs := urls[:0]
+	for _, u := range urls {
+		if !urlMap[u] {
+			urlMap[u] = true
+			uniqueURLs = append(uniqueURLs, u)
+		}
 	}
 
-	return
+	return uniqueURLs, nil
 }
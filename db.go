@@ -346,3 +346,19 @@ func RemoveExpiredCache(dbPath string, cacheLifeTime time.Duration) (err error)
 	}
 	return
 }
+
+// create the cache db if not exists, otherwise remove expired cache entries
+func InitCacheDB(dbPath string, cacheLifeTime time.Duration) (err error) {
+	if _, err = os.Stat(dbPath); nil != err && os.IsNotExist(err) {
+		log.Printf("creating cache database %s", dbPath)
+		return CreateDBScheme(dbPath)
+	}
+
+	log.Printf("found cache database %s", dbPath)
+	// remove expired cache entries
+	log.Printf("scanning cache db for expired entries...")
+	if cacheLifeTime > 0 {
+		RemoveExpiredCache(dbPath, cacheLifeTime)
+	}
+	return nil
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/xpath"
 	"net/url"
 	"regexp"
 	"strings"
@@ -22,14 +25,48 @@ const (
 	FEED_TYPE    = "rss"
 	FEED_VERSION = "2.0"
 
+	// output formats of generated feeds
+	FEED_FORMAT_RSS  = "rss"
+	FEED_FORMAT_ATOM = "atom"
+	FEED_FORMAT_JSON = "json"
+
+	// atom related
+	ATOM_NAMESPACE = "http://www.w3.org/2005/Atom"
+	// namespace used to generate name based uuids for atom entry ids, see rfc 4122
+	ATOM_UUID_URL_NAMESPACE = "6ba7b8119dad11d180b400c04fd430c8"
+
+	// rss extensions used for entry author and image
+	DC_NAMESPACE    = "http://purl.org/dc/elements/1.1/"
+	MEDIA_NAMESPACE = "http://search.yahoo.com/mrss/"
+	// mime type of entry image if it can not be told from the image url
+	DEFAULT_IMAGE_TYPE = "image/jpeg"
+
+	// json feed related
+	JSON_FEED_VERSION = "https://jsonfeed.org/version/1.1"
+
 	// used for extracting feed title/link/content
 	HTML_TITLE_REG = `(?s)<\s*?html.*?<\s*?head.*?<\s*?title\s*?>(?P<title>.+)</\s*?title`
 	// for cache life time
 	CACHE_LIFETIME_ALL_REG = `^([1-9][0-9]*[smhd])+$`
 	CACHE_LIFETIME_REG     = `([1-9][0-9]*)([smhd])`
 
-	PATTERN_ANY     = "{any}"
-	PATTERN_ANY_REG = "(?s).*?"
+	PATTERN_ANY      = "{any}"
+	PATTERN_ANY_NAME = "any"
+	PATTERN_ANY_REG  = "(?s).*?"
+	PATTERN_INT      = "int"
+	PATTERN_INT_REG  = "[0-9]+"
+	PATTERN_TEXT     = "text" // text between tags
+	PATTERN_TEXT_REG = "[^<>]*?"
+	// {text}, used by induced patterns
+	PATTERN_TEXT_FIELD = "{" + PATTERN_TEXT + "}"
+	PATTERN_WS         = "ws"
+	PATTERN_WS_REG     = `\s*`
+	// {attr:name} matches attribute name in the current tag, {attr:name:field} extracts its value as field
+	PATTERN_ATTR_PREFIX = "attr:"
+	// [[ a ]] is optional, [[ a || b ]] matches a or b
+	PATTERN_OPTIONAL_START = "[["
+	PATTERN_ALTERNATIVE    = "||"
+	PATTERN_OPTIONAL_END   = "]]"
 
 	PATTERN_TITLE   = "title"
 	PATTERN_LINK    = "link"
@@ -37,6 +74,12 @@ const (
 	PATTERN_PUBDATE = "pubdate"
 	PATTERN_FILTER  = "filter"
 
+	// optional entry fields, custom fields in Feed.Fields are mapped to them
+	PATTERN_AUTHOR   = "author"
+	PATTERN_CATEGORY = "category"
+	PATTERN_IMAGE    = "image"
+	PATTERN_SUMMARY  = "summary"
+
 	PATTERN_YEAR   = "year"
 	PATTERN_MONTH  = "month"
 	PATTERN_DAY    = "day"
@@ -44,12 +87,241 @@ const (
 	PATTERN_MINUTE = "minute"
 	PATTERN_SECOND = "second"
 
+	// built-in extractors
+	EXTRACTOR_PATTERN  = "pattern"
+	EXTRACTOR_XPATH    = "xpath"
+	EXTRACTOR_SELECTOR = "selector"
+	EXTRACTOR_FEED     = "feed"
+	EXTRACTOR_JSON     = "json"
+	EXTRACTOR_SITEMAP  = "sitemap"
+	// main content of the page is guessed by text and link density, see readability.go
+	EXTRACTOR_READABILITY = "readability"
+	// microformats2 h-entry items of the index and content pages, see microformats.go
+	EXTRACTOR_HFEED = "h-feed"
+	MF2_ENTRY_CLASS = "h-entry"
+
+	// paragraphs with shorter text are not scored by the readability extractor
+	READABILITY_MIN_TEXT_LEN = 25
+	// bonus or penalty of the class and id names matching READABILITY_POSITIVE_REGEX or READABILITY_NEGATIVE_REGEX
+	READABILITY_CLASS_WEIGHT = 25
+	// nodes with lower score are not readable content, which is less than two paragraphs without commas
+	READABILITY_MIN_SCORE = 2
+
+	// default number of index pages crawled for each Feed.URL when Feed.NextPagePattern is defined
+	INDEX_MAX_PAGES = 5
+
+	// default number of pages of a multi-page article when Feed.ContentNextPagePattern is defined
+	CONTENT_MAX_PAGES = 10
+
+	// date placeholders of url templates, see ExpandURLTemplate
+	URL_TEMPLATE_YEAR  = "{yyyy}"
+	URL_TEMPLATE_MONTH = "{mm}"
+	URL_TEMPLATE_DAY   = "{dd}"
+	// max number of urls expanded from one url template
+	URL_TEMPLATE_MAX_URLS = 100
+
+	// default number of entries read from sitemaps, the latest ones are kept
+	SITEMAP_MAX_ENTRIES = 50
+
+	// timestamps greater than this are in milliseconds, which is 2001-09-09 in milliseconds
+	UNIX_MILLI_TIMESTAMP_MIN = 1000000000000
+
+	// sub commands, see showUsage
+	CMD_TEST   = "test"
+	CMD_CHECK  = "check"
+	CMD_INDUCE = "induce"
+	CMD_UI     = "ui"
+	CMD_INIT   = "init"
+	// default number of entries whose content pages are tested by gofeed test
+	TEST_MAX_ENTRIES = 3
+	// longer titles and links are truncated in the result table of gofeed test
+	TEST_COLUMN_WIDTH = 50
+
+	// html trace reports of failed patterns are written to this directory under the
+	// system temp directory by default, see the -trace flag
+	TRACE_DIR_NAME = "gofeed_trace"
+	// css classes of trace segments
+	TRACE_CLASS_MATCHED   = "matched"
+	TRACE_CLASS_UNMATCHED = "unmatched"
+	TRACE_CLASS_FILTERED  = "filtered"
+	TRACE_CLASS_BREAK     = "break"
+	TRACE_REPORT_TEMPLATE = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gofeed trace {{.Page}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { white-space: pre-wrap; word-break: break-all; background: #f7f7f7; padding: 1em; }
+.matched { background: #b5e8b0; }
+.unmatched { background: #f5b7b1; }
+.filtered { background: #d6e4f5; }
+.break { border-left: 3px solid #e00; }
+</style>
+</head>
+<body>
+<h1>pattern did not match</h1>
+<p>page: {{.Page}}<br>date: {{.Date}}</p>
+<h2>regex</h2>
+<p>The green part is the longest prefix which matches, the red part failed to match at <a href="#break">offset {{.BreakPos}}</a>.</p>
+<pre>{{range .Regex}}<span class="{{.Class}}">{{.Text}}</span>{{end}}</pre>
+{{if .FilterRegex}}<h2>filter regex</h2>
+<pre>{{.FilterRegex}}</pre>
+<h2>filtered data</h2>
+<pre>{{range .FilteredData}}<span{{if .ID}} id="{{.ID}}"{{end}} class="{{.Class}}">{{.Text}}</span>{{end}}</pre>
+{{end}}<h2>page</h2>
+<pre>{{range .PageData}}<span{{if .ID}} id="{{.ID}}"{{end}} class="{{.Class}}">{{.Text}}</span>{{end}}</pre>
+</body>
+</html>
+`
+
+	// max number of html tokens before and after the examples in the induced patterns
+	INDUCE_MAX_CONTEXT = 4
+
+	// link groups with fewer entries are not index candidates of gofeed init
+	INIT_MIN_ENTRIES = 3
+	// number of entry titles used to induce the index pattern by gofeed init
+	INIT_MAX_EXAMPLES = 3
+
+	// web ui of gofeed ui, only the local host can visit it by default
+	UI_DEFAULT_ADDR = "127.0.0.1:8043"
+	// patterns are previewed after they have not been changed for this many milliseconds
+	UI_PREVIEW_DELAY = 500
+	// longer descriptions are truncated in the preview
+	UI_DESCRIPTION_WIDTH = 200
+	UI_PAGE              = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gofeed ui</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+label { display: block; margin-top: .5em; font-weight: bold; }
+input[type=text], textarea { width: 100%; box-sizing: border-box; font-family: monospace; }
+pre { white-space: pre-wrap; word-break: break-all; background: #f7f7f7; padding: 1em; max-height: 30em; overflow: auto; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border: 1px solid #ddd; padding: .2em .5em; text-align: left; vertical-align: top; }
+.failed { background: #f5b7b1; }
+#issues { white-space: pre-wrap; color: #c00; }
+.columns { display: flex; gap: 2em; }
+.columns > div { flex: 1; min-width: 0; }
+</style>
+</head>
+<body>
+<h1>gofeed ui</h1>
+<div class="columns">
+<div>
+<label>Feed.URL</label><input type="text" id="URL"> <button id="fetch">fetch</button>
+<label>Feed.Title</label><input type="text" id="Title">
+<label>Feed.Path</label><input type="text" id="Path" value="feed.xml">
+<label>Feed.IndexFilterPattern</label><textarea id="IndexFilterPattern" rows="2"></textarea>
+<label>Feed.IndexPattern</label><textarea id="IndexPattern" rows="3"></textarea>
+<label>Feed.ContentFilterPattern</label><textarea id="ContentFilterPattern" rows="2"></textarea>
+<label>Feed.ContentPattern</label><textarea id="ContentPattern" rows="3"></textarea>
+<label>Feed.PubDatePattern</label><input type="text" id="PubDatePattern">
+<h2>config</h2>
+<pre id="config"></pre>
+</div>
+<div>
+<h2>steps</h2>
+<div id="issues"></div>
+<table id="steps"></table>
+<h2>entries</h2>
+<table id="entries"></table>
+<h2>minified html</h2>
+<pre id="html"></pre>
+</div>
+</div>
+<script>
+var fields = ["URL", "Title", "Path", "IndexFilterPattern", "IndexPattern", "ContentFilterPattern", "ContentPattern", "PubDatePattern"];
+var timer = null;
+
+function post(path, callback) {
+	var req = {};
+	fields.forEach(function(f) { req[f] = document.getElementById(f).value; });
+	var xhr = new XMLHttpRequest();
+	xhr.open("POST", path);
+	xhr.setRequestHeader("Content-Type", "application/json");
+	xhr.onload = function() { callback(JSON.parse(xhr.responseText)); };
+	xhr.send(JSON.stringify(req));
+}
+
+function fillTable(id, head, rows, failed) {
+	var table = document.getElementById(id);
+	table.innerHTML = "";
+	[head].concat(rows).forEach(function(row, ind) {
+		var tr = table.insertRow();
+		if (0 < ind && failed && failed[ind-1]) { tr.className = "failed"; }
+		row.forEach(function(text) {
+			var td = document.createElement(0 == ind ? "th" : "td");
+			td.textContent = text;
+			tr.appendChild(td);
+		});
+	});
+}
+
+function preview() {
+	if ("" == document.getElementById("URL").value || "" == document.getElementById("IndexPattern").value) {
+		return;
+	}
+	post("/preview", function(resp) {
+		document.getElementById("issues").textContent = (resp.Issues || []).concat(resp.Error ? [resp.Error] : []).join("\n");
+		var steps = resp.Steps || [], entries = resp.Entries || [];
+		fillTable("steps", ["STEP", "KEY", "PAGE", "RESULT"],
+			steps.map(function(s) { return [s.Step, s.Key, s.Page, s.Result]; }),
+			steps.map(function(s) { return s.Failed; }));
+		fillTable("entries", ["#", "TITLE", "LINK", "PUBDATE", "DESCRIPTION"],
+			entries.map(function(e, ind) { return [ind+1, e.Title, e.Link, e.PubDate, e.Description]; }));
+		document.getElementById("config").textContent = resp.Config;
+	});
+}
+
+document.getElementById("fetch").onclick = function() {
+	post("/fetch", function(resp) {
+		document.getElementById("html").textContent = resp.Error || resp.Html;
+		preview();
+	});
+};
+fields.forEach(function(f) {
+	document.getElementById(f).oninput = function() {
+		clearTimeout(timer);
+		timer = setTimeout(preview, {{.PreviewDelay}});
+	};
+});
+</script>
+</body>
+</html>
+`
+
 	// db related consts
 	DB_DRIVER           = "sqlite3"
 	DB_NAME             = "cache.db"
 	DB_HTML_CACHE_TABLE = "html_cache"
 )
 
+// tokens of patterns, see TokenizePattern
+const (
+	PATTERN_TOKEN_TEXT = iota
+	PATTERN_TOKEN_FIELD
+	PATTERN_TOKEN_ATTR
+	PATTERN_TOKEN_OPTIONAL_START
+	PATTERN_TOKEN_ALTERNATIVE
+	PATTERN_TOKEN_OPTIONAL_END
+)
+
+// levels of pattern lint issues
+const (
+	LINT_ERROR = "ERROR"
+	LINT_WARN  = "WARN"
+)
+
+// steps of json path
+const (
+	JSON_PATH_KEY = iota
+	JSON_PATH_INDEX
+	JSON_PATH_WILDCARD
+)
+
 var (
 	// used to set http client header User-Agent
 	GOFEED_AGENT = fmt.Sprintf("Mozilla/5.0 (compatible; %s/%s; +%s)", GOFEED_NAME, GOFEED_VERSION, GOFEED_PROJECT)
@@ -64,11 +336,94 @@ var (
 	HTML_WHITESPACE_REPL   = []byte(">")
 	HTML_WHITESPACE_REPL2  = []byte("<")
 
+	// used for splitting css selector and attribute name, "h2 a@href" for example
+	CSS_SELECTOR_ATTR_REGEX = regexp.MustCompile(`^(.*?)@([-_:a-zA-Z0-9]+)$`)
+
+	// used for tokenizing patterns
+	PATTERN_ATTR_NAME_REGEX   = regexp.MustCompile(`^[-_a-zA-Z0-9]+$`)
+	PATTERN_POSIX_CLASS_REGEX = regexp.MustCompile(`^\[\[:[a-z]+:\]`)
+
+	// name of custom fields in Feed.Fields
+	CUSTOM_FIELD_NAME_REGEX = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// numeric range of url templates, {1..5} or {01..12}
+	URL_TEMPLATE_RANGE_REGEX = regexp.MustCompile(`\{(\d+)\.\.(\d+)\}`)
+
+	// used for inducing patterns from examples
+	HTML_TOKEN_REGEX    = regexp.MustCompile(`<[^<>]*>|[^<]+|<`)
+	HTML_TAG_NAME_REGEX = regexp.MustCompile(`^<(/?)([a-zA-Z][-a-zA-Z0-9]*)`)
+	HTML_ATTR_REGEX     = regexp.MustCompile(`([-_:a-zA-Z0-9]+)="([^"]*)"`)
+	// void elements have no closing tags
+	HTML_VOID_TAGS = []string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "param", "source", "track", "wbr"}
+	// elements which may contain the whole article, article and main are preferred even without id or class
+	INDUCE_CONTENT_TAGS = []string{"article", "main", "section", "div", "td"}
+
+	// used for detecting feeds of a page, types of <link rel="alternate"> which can be read by the feed extractor
+	HTML_LINK_TAG_REGEX = regexp.MustCompile(`<link\s[^>]*>`)
+	FEED_MIME_TYPES     = []string{"application/rss+xml", "application/atom+xml", "application/rdf+xml"}
+
+	// used by the readability extractor, unlikely nodes are removed before scoring
+	READABILITY_REMOVED_TAGS   = []string{"script", "style", "noscript", "iframe", "form", "nav", "header", "footer", "aside"}
+	READABILITY_UNLIKELY_REGEX = regexp.MustCompile(`(?i)comment|sidebar|footer|header|menu|nav|share|social|related|popup|advert|banner|sponsor`)
+	READABILITY_POSITIVE_REGEX = regexp.MustCompile(`(?i)article|content|post|entry|main|body|text|story`)
+	READABILITY_NEGATIVE_REGEX = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|widget|share|related|tag|combx|masthead|promo`)
+
+	// used for extracting metadata of articles, see Feed.Metadata
+	JSONLD_SCRIPT_REGEX       = regexp.MustCompile(`(?is)<script[^>]*application/ld\+json[^>]*>(.*?)</script>`)
+	JSONLD_ARTICLE_TYPE_REGEX = regexp.MustCompile(`(Article|Posting)$`)
+	HTML_META_TAG_REGEX       = regexp.MustCompile(`(?i)<meta\s[^>]*>`)
+	// property or name of meta tags -> entry field, the first one of each field is used
+	METADATA_META_FIELDS = map[string]string{
+		"og:title":               PATTERN_TITLE,
+		"article:published_time": PATTERN_PUBDATE,
+		"article:author":         PATTERN_AUTHOR,
+		"author":                 PATTERN_AUTHOR,
+		"og:image":               PATTERN_IMAGE,
+	}
+
+	// entry field -> properties of h-entry, the first property found is used. Categories are
+	// all the values of p-category
+	MF2_ENTRY_PROPERTIES = map[string][]string{
+		PATTERN_TITLE:    {"p-name"},
+		PATTERN_LINK:     {"u-url", "u-uid"},
+		PATTERN_PUBDATE:  {"dt-published", "dt-updated"},
+		PATTERN_CONTENT:  {"e-content"},
+		PATTERN_SUMMARY:  {"p-summary"},
+		PATTERN_AUTHOR:   {"p-author"},
+		PATTERN_CATEGORY: {"p-category"},
+		PATTERN_IMAGE:    {"u-photo", "u-featured"},
+	}
+
+	MF2_ROOT_CLASS_REGEX     = regexp.MustCompile(`^h-[a-z0-9-]+$`)
+	MF2_PROPERTY_CLASS_REGEX = regexp.MustCompile(`^(p|u|dt|e)-[a-z0-9-]+$`)
+	// property prefix -> tag name -> attribute holding the value, the text is used for other tags
+	MF2_VALUE_ATTRS = map[string]map[string]string{
+		"p-":  {"img": "alt", "area": "alt", "abbr": "title", "data": "value", "input": "value"},
+		"u-":  {"a": "href", "area": "href", "link": "href", "img": "src", "audio": "src", "video": "src", "source": "src", "object": "data"},
+		"dt-": {"time": "datetime", "ins": "datetime", "del": "datetime", "abbr": "title", "data": "value", "input": "value"},
+	}
+
 	// used for removing junk entry content
 	HTML_SCRIPT_TAG = regexp.MustCompile(`<script(?s).*?</script>`)
 
 	// time related stuff
 	GOFEED_DEFAULT_TIMEZONE, _ = time.LoadLocation("Asia/Shanghai")
+	// used for parsing pubdate without Feed.PubDatePattern, layouts without timezone are in GOFEED_DEFAULT_TIMEZONE
+	STANDARD_TIME_LAYOUTS = []string{
+		time.RFC1123Z,
+		time.RFC1123,
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 2 Jan 2006 15:04:05 MST",
+		"2 Jan 2006 15:04:05 -0700",
+		time.RFC822Z,
+		time.RFC822,
+		time.RFC3339,
+		"2006-01-02T15:04Z07:00", // w3c datetime used by sitemaps
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	}
 )
 
 type Config struct {
@@ -79,32 +434,257 @@ type Config struct {
 }
 
 type TargetConfig struct {
-	Title                 string        `json:"Feed.Title"`
-	Description           string        `json:"Feed.Description"`
-	URLs                  []string      `json:"Feed.URL"`
-	IndexPatterns         []string      `json:"Feed.IndexPattern"`
-	ContentPatterns       []string      `json:"Feed.ContentPattern"`
-	IndexFilterPatterns   []string      `json:"Feed.IndexFilterPattern"`
-	ContentFilterPatterns []string      `json:"Feed.ContentFilterPattern"`
-	PubDatePatterns       []string      `json:"Feed.PubDatePattern"`
-	FeedPath              string        `json:"Feed.Path"`
-	ReqInterval           time.Duration `json:"Request.Interval"`
+	Title                  string             `json:"Feed.Title"`
+	Description            string             `json:"Feed.Description"`
+	URLs                   []string           `json:"Feed.URL"`
+	URLLookback            int                `json:"Feed.URLLookback"`     // days before today expanded in url templates
+	Mode                   string             `json:"Feed.Mode"`            // extractor of index html, "" means inferred from the rules
+	ContentMode            string             `json:"Feed.ContentMode"`     // extractor of content html, "" means inferred from the rules
+	ContentFallback        string             `json:"Feed.ContentFallback"` // extractor used when Feed.ContentMode fails, "" means none
+	ExtractorOptions       json.RawMessage    `json:"Feed.ExtractorOptions"`
+	IndexPatterns          []string           `json:"Feed.IndexPattern"`
+	ContentPatterns        []string           `json:"Feed.ContentPattern"`
+	IndexFilterPatterns    []string           `json:"Feed.IndexFilterPattern"`
+	ContentFilterPatterns  []string           `json:"Feed.ContentFilterPattern"`
+	PubDatePatterns        []string           `json:"Feed.PubDatePattern"`
+	IndexXPath             *ExtractRuleConfig `json:"Feed.IndexXPath"`
+	ContentXPath           *ExtractRuleConfig `json:"Feed.ContentXPath"`
+	IndexSelector          *ExtractRuleConfig `json:"Feed.IndexSelector"`
+	ContentSelector        *ExtractRuleConfig `json:"Feed.ContentSelector"`
+	IndexJsonPath          *ExtractRuleConfig `json:"Feed.IndexJsonPath"`
+	NextPagePattern        string             `json:"Feed.NextPagePattern"`
+	MaxPages               int                `json:"Feed.MaxPages"` // 0 means INDEX_MAX_PAGES
+	ContentNextPagePattern string             `json:"Feed.ContentNextPagePattern"`
+	ContentMaxPages        int                `json:"Feed.ContentMaxPages"` // 0 means CONTENT_MAX_PAGES
+	Navigation             []NavigationConfig `json:"Feed.Navigation"`
+	Fields                 map[string]string  `json:"Feed.Fields"`   // custom placeholder name -> author, category, image or summary
+	Tests                  []FixtureConfig    `json:"Feed.Tests"`    // offline tests evaluated by gofeed check
+	Metadata               bool               `json:"Feed.Metadata"` // fill the missing fields with json-ld and opengraph of content pages
+	FeedPath               string             `json:"Feed.Path"`
+	FeedFormat             string             `json:"Feed.Format"` // "" means rss, "atom" and "json" are also acceptable
+	Outputs                []OutputConfig     `json:"Feed.Outputs"`
+	ReqInterval            time.Duration      `json:"Request.Interval"`
+}
+
+// rules used to extract feed entries from html dom, Entry is only used for index pages
+type ExtractRuleConfig struct {
+	Entry       string `json:"Entry"`
+	Title       string `json:"Title"`
+	Link        string `json:"Link"`
+	Description string `json:"Description"`
+	PubDate     string `json:"PubDate"`
+}
+
+type PatternToken struct {
+	Type  int
+	Pos   int    // byte offset in the pattern
+	Text  string // raw text of the token
+	Name  string // name of {field} or {attr:name}
+	Field string // field of {attr:name:field}
+}
+
+// syntax error of pattern at byte offset Pos
+type PatternError struct {
+	Pos int
+	Msg string
+}
+
+// issue of patterns found by LintPatterns
+type PatternIssue struct {
+	Level   string // LINT_ERROR or LINT_WARN
+	Target  string // title or path of the feed target
+	Key     string // config key, Feed.IndexPattern[1] for example
+	Pos     int    // byte offset in the pattern, -1 if the issue is not at a position
+	Message string
+}
+
+// a navigation step from the {link} pages to the next level pages, such as category pages to articles
+type NavigationConfig struct {
+	Pattern       string `json:"Pattern"`
+	FilterPattern string `json:"FilterPattern"`
+}
+
+// sample pages and the expected results of a target, see gofeed check
+type FixtureConfig struct {
+	URL         string   `json:"URL"`         // url of the sample pages, default is the first Feed.URL
+	IndexFile   string   `json:"IndexFile"`   // local index page, relative to the config file
+	Titles      []string `json:"Titles"`      // expected titles of all the entries in IndexFile, in order
+	Links       []string `json:"Links"`       // expected links of all the entries in IndexFile, in order
+	ContentFile string   `json:"ContentFile"` // local content page, relative to the config file
+	Description string   `json:"Description"` // expected prefix of the description extracted from ContentFile
+}
+
+type OutputConfig struct {
+	Path   string `json:"Path"`
+	Format string `json:"Format"` // "" means rss
+	Gzip   bool   `json:"Gzip"`
 }
 
 type FeedTarget struct {
-	Title             string
-	Description       string
-	URLs              []*url.URL
-	IndexRegs         []*regexp.Regexp
-	ContentRegs       []*regexp.Regexp
-	IndexFilterRegs   []*regexp.Regexp
-	ContentFilterRegs []*regexp.Regexp
-	PubDateRegs       []*regexp.Regexp
-	FeedPath          string
-	ReqInterval       time.Duration
-	CacheDB           string
-	CacheLifetime     time.Duration
-	HttpTimeout       time.Duration
+	Title              string
+	Description        string
+	URLs               []*url.URL       // urls expanded from the url templates of Feed.URL
+	URLIndexes         map[*url.URL]int // url -> index of the Feed.URL it is expanded from
+	URLNum             int              // number of Feed.URL before expanding url templates
+	IndexRegs          []*regexp.Regexp
+	ContentRegs        []*regexp.Regexp
+	IndexFilterRegs    []*regexp.Regexp
+	ContentFilterRegs  []*regexp.Regexp
+	PubDateRegs        []*regexp.Regexp
+	IndexXPath         *XPathRule
+	ContentXPath       *XPathRule
+	IndexSelector      *SelectorRule
+	ContentSelector    *SelectorRule
+	IndexJsonPath      *JsonPathRule
+	NextPageReg        *regexp.Regexp
+	MaxPages           int                   // max number of index pages crawled for each Feed.URL
+	IndexPageOrigins   map[*url.URL]*url.URL // next index page -> Feed.URL it comes from
+	ContentNextPageReg *regexp.Regexp
+	ContentMaxPages    int // max number of pages of a multi-page article
+	Navigation         []*NavigationStep
+	IndexMode          string
+	ContentMode        string
+	IndexExtractor     Extractor
+	ContentExtractor   Extractor
+	FallbackMode       string
+	FallbackExtractor  Extractor // nil if Feed.ContentFallback is not defined
+	Metadata           bool
+	FeedPath           string // path of the first output, used to identify the target
+	Outputs            []*FeedOutput
+	ReqInterval        time.Duration
+	CacheDB            string
+	CacheLifetime      time.Duration
+	HttpTimeout        time.Duration
+}
+
+// the longest prefix of Regex which matches the data, see TraceRegex
+type RegexTrace struct {
+	Regex      string
+	MatchedLen int // length of the matched prefix of Regex
+	MatchStart int // offset of the prefix match in data
+	MatchEnd   int // offset where matching broke down
+}
+
+// part of the data shown in trace reports, Class is one of TRACE_CLASS_*
+type TraceSegment struct {
+	Text  string
+	Class string
+	ID    string
+}
+
+// data of TRACE_REPORT_TEMPLATE
+type TraceReport struct {
+	Page         string
+	Date         string
+	BreakPos     int
+	Regex        []TraceSegment
+	FilterRegex  string
+	FilteredData []TraceSegment // data left by the filter regex, where the regex is traced
+	PageData     []TraceSegment
+}
+
+// result of a step of gofeed test, such as filtering or matching a page with a pattern
+type TestStep struct {
+	Step   string // filter, index, navigation, content, etc.
+	Key    string // config key of the pattern or extractor
+	Page   string
+	Result string
+	Failed bool
+	Trace  string // path of the html trace report if the step failed
+}
+
+// request of the web ui, the patterns of a target being edited
+type UIRequest struct {
+	URL                  string
+	Title                string
+	Path                 string
+	IndexFilterPattern   string
+	IndexPattern         string
+	ContentFilterPattern string
+	ContentPattern       string
+	PubDatePattern       string
+}
+
+type UIFetchResponse struct {
+	Html  string
+	Error string
+}
+
+type UIPreviewResponse struct {
+	Issues  []string // pattern lint issues
+	Error   string
+	Steps   []TestStep
+	Entries []UIEntry
+	Config  string // json of the target, which can be pasted into Targets of the config file
+}
+
+type UIEntry struct {
+	Title       string
+	Link        string
+	PubDate     string
+	Description string
+}
+
+// flag which can be repeated, such as -title of gofeed induce
+type StringsFlag []string
+
+// compiled NavigationConfig
+type NavigationStep struct {
+	Reg       *regexp.Regexp
+	FilterReg *regexp.Regexp // nil means no filter
+}
+
+// compiled ExtractRuleConfig, nil means the field will not be extracted
+type XPathRule struct {
+	Entry       *xpath.Expr
+	Title       *xpath.Expr
+	Link        *xpath.Expr
+	Description *xpath.Expr
+	PubDate     *xpath.Expr
+}
+
+// one step of a json path, .key, [index] or [*]
+type JsonPathStep struct {
+	Type  int
+	Key   string
+	Index int // negative index counts from the end of array
+}
+
+// json path such as $.data.list[*], which is a subset of JSONPath
+type JsonPath struct {
+	Raw   string
+	Steps []JsonPathStep
+}
+
+// compiled ExtractRuleConfig, nil means the field will not be extracted
+type JsonPathRule struct {
+	Entry       *JsonPath
+	Title       *JsonPath
+	Link        *JsonPath
+	Description *JsonPath
+	PubDate     *JsonPath
+}
+
+// css selector with an optional attribute name, "h2 a@href" for example
+type CssSelector struct {
+	Raw      string
+	Selector cascadia.Selector // nil means the entry node itself
+	Attr     string
+}
+
+// compiled ExtractRuleConfig, nil means the field will not be extracted
+type SelectorRule struct {
+	Entry       *CssSelector
+	Title       *CssSelector
+	Link        *CssSelector
+	Description *CssSelector
+	PubDate     *CssSelector
+}
+
+type FeedOutput struct {
+	Path   string
+	Format string
+	Gzip   bool
 }
 
 type Feed struct {
@@ -120,14 +700,20 @@ type FeedEntry struct {
 	Title        string
 	Link         *url.URL // Link == nil means entry is invalid
 	PubDate      *time.Time
+	Categories   []string
+	Author       string
+	Image        *url.URL
+	Summary      string
 	Content      []byte     // entry description
 	Cache        *HtmlCache // Cache == nil means entry is invalid
 }
 
 type Rss2Feed struct {
-	XMLName xml.Name    `xml:"rss"`
-	Version string      `xml:"version,attr"`
-	Channel Rss2Channel `xml:"channel"`
+	XMLName    xml.Name    `xml:"rss"`
+	Version    string      `xml:"version,attr"`
+	XmlnsDc    string      `xml:"xmlns:dc,attr,omitempty"`
+	XmlnsMedia string      `xml:"xmlns:media,attr,omitempty"`
+	Channel    Rss2Channel `xml:"channel"`
 }
 
 type Rss2Channel struct {
@@ -140,11 +726,153 @@ type Rss2Channel struct {
 }
 
 type Rss2Item struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description",chardata`
-	PubDate     string `xml:"pubDate"`
-	Guid        string `xml:"guid"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	PubDate     string   `xml:"pubDate"`
+	Guid        string   `xml:"guid"`
+	Categories  []string `xml:"category"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Enclosure   *Rss2Enclosure
+	Thumbnail   *MediaThumbnail
+}
+
+type Rss2Enclosure struct {
+	XMLName xml.Name `xml:"enclosure"`
+	URL     string   `xml:"url,attr"`
+	Length  int      `xml:"length,attr"`
+	Type    string   `xml:"type,attr"`
+}
+
+type MediaThumbnail struct {
+	XMLName xml.Name `xml:"media:thumbnail"`
+	URL     string   `xml:"url,attr"`
+}
+
+type AtomFeed struct {
+	XMLName   xml.Name      `xml:"feed"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	Id        string        `xml:"id"`
+	Title     string        `xml:"title"`
+	Subtitle  string        `xml:"subtitle,omitempty"`
+	Updated   string        `xml:"updated"`
+	Links     []AtomLink    `xml:"link"`
+	Author    AtomPerson    `xml:"author"`
+	Generator AtomGenerator `xml:"generator"`
+	Entries   []AtomEntry   `xml:"entry"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type AtomGenerator struct {
+	URI     string `xml:"uri,attr"`
+	Version string `xml:"version,attr"`
+	Name    string `xml:",chardata"`
+}
+
+type AtomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type AtomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type AtomEntry struct {
+	Id         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Links      []AtomLink     `xml:"link"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+	Summary    *AtomContent   `xml:"summary"`
+	Content    AtomContent    `xml:"content"`
+}
+
+type JsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Items       []JsonFeedItem `json:"items"`
+}
+
+type JsonFeedItem struct {
+	Id            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title,omitempty"`
+	ContentHtml   string           `json:"content_html"`
+	DatePublished string           `json:"date_published"`
+	Tags          []string         `json:"tags,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	Authors       []JsonFeedAuthor `json:"authors,omitempty"`
+}
+
+type JsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// rss 2.0, rss 1.0 or atom 1.0 feed used as index page
+type SourceFeed struct {
+	XMLName xml.Name
+	Items   []SourceFeedItem  `xml:"channel>item"`
+	RdfItem []SourceFeedItem  `xml:"item"` // items of rss 1.0 are children of rdf:RDF
+	Entries []SourceAtomEntry `xml:"entry"`
+}
+
+// sitemap or sitemap index, see http://www.sitemaps.org/protocol.html
+type SourceSitemap struct {
+	XMLName  xml.Name
+	Urls     []SitemapURL `xml:"url"`
+	Sitemaps []SitemapURL `xml:"sitemap"`
+}
+
+type SitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+	// title and publication date of google news sitemaps
+	NewsTitle   string `xml:"news>title"`
+	NewsPubDate string `xml:"news>publication_date"`
+}
+
+// Feed.ExtractorOptions of the sitemap extractor
+type SitemapOptions struct {
+	MaxEntries  int    `json:"MaxEntries"`  // 0 means SITEMAP_MAX_ENTRIES
+	LinkPattern string `json:"LinkPattern"` // regex, only links matched are used
+}
+
+type SourceFeedItem struct {
+	Title       string   `xml:"title"`
+	Links       []string `xml:"link"`
+	Guid        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	DcDate      string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Categories  []string `xml:"category"`
+}
+
+type SourceAtomEntry struct {
+	Title      string         `xml:"title"`
+	Links      []AtomLink     `xml:"link"`
+	Id         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    string         `xml:"summary"`
+	Content    string         `xml:"content"`
+	Categories []AtomCategory `xml:"category"`
 }
 
 const (
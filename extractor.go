@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// raw values extracted from content html, keyed by field name(description, pubdate, etc.)
+type EntryFields map[string][]byte
+
+// Extractor extracts feed entries from index html and entry fields from content html.
+// Index and content html of a feed target may use different extractors, see Feed.Mode
+// and Feed.ContentMode.
+type Extractor interface {
+	// extract entries from the index page at indexURL, entry links should be absolute
+	ExtractIndex(feed *Feed, indexURL *url.URL, htmlData []byte) ([]*FeedEntry, error)
+	// extract description, pubdate and other fields of entry from its content page
+	ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (EntryFields, error)
+}
+
+// index extractors of xml or json data implement RawDataExtractor to get the page as it is
+// downloaded, other extractors get the minified html without scripts
+type RawDataExtractor interface {
+	RawData() bool
+}
+
+// data of the index page passed to the index extractor of feedTar, rawData is the gunzipped page
+// and htmlData is the minified html
+func IndexExtractorData(feedTar *FeedTarget, rawData, htmlData []byte) []byte {
+	if ext, ok := feedTar.IndexExtractor.(RawDataExtractor); ok && ext.RawData() {
+		return rawData
+	}
+	return htmlData
+}
+
+// create an extractor for the feed target, patterns and rules of the target have been
+// compiled when the factory is called
+type ExtractorFactory func(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error)
+
+var gExtractorFactories = make(map[string]ExtractorFactory)
+
+func init() {
+	RegisterExtractor(EXTRACTOR_PATTERN, NewRegexExtractor)
+	RegisterExtractor(EXTRACTOR_XPATH, NewXPathExtractor)
+	RegisterExtractor(EXTRACTOR_SELECTOR, NewSelectorExtractor)
+	RegisterExtractor(EXTRACTOR_FEED, NewFeedExtractor)
+	RegisterExtractor(EXTRACTOR_JSON, NewJsonExtractor)
+	RegisterExtractor(EXTRACTOR_SITEMAP, NewSitemapExtractor)
+	RegisterExtractor(EXTRACTOR_READABILITY, NewReadabilityExtractor)
+	RegisterExtractor(EXTRACTOR_HFEED, NewHFeedExtractor)
+}
+
+// register an extractor which can be used in Feed.Mode and Feed.ContentMode,
+// should be called in init functions
+func RegisterExtractor(name string, factory ExtractorFactory) {
+	if _, ok := gExtractorFactories[name]; ok {
+		log.Fatalf("[ERROR] extractor %s already registered", name)
+	}
+	gExtractorFactories[name] = factory
+}
+
+func GetExtractorNames() (names []string) {
+	for name := range gExtractorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Feed.Mode and Feed.ContentMode default to the extraction rules defined in the target
+func ResolveExtractorModes(tar *TargetConfig) (indexMode, contentMode string, err error) {
+	indexMode = strings.ToLower(strings.TrimSpace(tar.Mode))
+	if "" == indexMode {
+		if nil != tar.IndexXPath {
+			indexMode = EXTRACTOR_XPATH
+		} else if nil != tar.IndexSelector {
+			indexMode = EXTRACTOR_SELECTOR
+		} else if nil != tar.IndexJsonPath {
+			indexMode = EXTRACTOR_JSON
+		} else {
+			indexMode = EXTRACTOR_PATTERN
+		}
+	}
+
+	contentMode = strings.ToLower(strings.TrimSpace(tar.ContentMode))
+	if "" == contentMode {
+		if nil != tar.ContentXPath {
+			contentMode = EXTRACTOR_XPATH
+		} else if nil != tar.ContentSelector {
+			contentMode = EXTRACTOR_SELECTOR
+		} else if EXTRACTOR_HFEED == indexMode && 0 == len(tar.ContentPatterns) {
+			// permalink pages of h-entry items are h-entry too
+			contentMode = EXTRACTOR_HFEED
+		} else {
+			contentMode = EXTRACTOR_PATTERN
+		}
+	}
+
+	// check rules of built-in extractors
+	if (EXTRACTOR_XPATH == indexMode && nil == tar.IndexXPath) ||
+		(EXTRACTOR_SELECTOR == indexMode && nil == tar.IndexSelector) ||
+		(EXTRACTOR_JSON == indexMode && nil == tar.IndexJsonPath) ||
+		(EXTRACTOR_XPATH == contentMode && nil == tar.ContentXPath) ||
+		(EXTRACTOR_SELECTOR == contentMode && nil == tar.ContentSelector) {
+		err = errors.New("extraction rules of Feed.Mode " + indexMode + " or Feed.ContentMode " + contentMode + " not defined")
+		return
+	}
+
+	return
+}
+
+func CreateExtractors(feedTar *FeedTarget, tar *TargetConfig) (err error) {
+	feedTar.IndexMode, feedTar.ContentMode, err = ResolveExtractorModes(tar)
+	if nil != err {
+		return
+	}
+
+	for _, ext := range []struct {
+		mode      string
+		extractor *Extractor
+	}{
+		{feedTar.IndexMode, &feedTar.IndexExtractor},
+		{feedTar.ContentMode, &feedTar.ContentExtractor},
+	} {
+		factory, ok := gExtractorFactories[ext.mode]
+		if !ok {
+			return errors.New("unknown extractor " + ext.mode + ", should be one of " + strings.Join(GetExtractorNames(), ", "))
+		}
+		*ext.extractor, err = factory(feedTar, tar)
+		if nil != err {
+			log.Printf("[ERROR] failed to create extractor %s: %s", ext.mode, err)
+			return
+		}
+	}
+
+	// optional fallback of the content extractor
+	feedTar.FallbackMode = strings.ToLower(strings.TrimSpace(tar.ContentFallback))
+	if "" == feedTar.FallbackMode {
+		return
+	}
+	factory, ok := gExtractorFactories[feedTar.FallbackMode]
+	if !ok {
+		return errors.New("unknown Feed.ContentFallback " + feedTar.FallbackMode + ", should be one of " + strings.Join(GetExtractorNames(), ", "))
+	}
+	if feedTar.FallbackExtractor, err = factory(feedTar, tar); nil != err {
+		log.Printf("[ERROR] failed to create extractor %s: %s", feedTar.FallbackMode, err)
+	}
+	return
+}
+
+// extract content html with the content extractor of feedTar. If it fails or extracts no description,
+// the description is extracted with the fallback extractor instead.
+func ExtractContentWithFallback(feedTar *FeedTarget, feed *Feed, entry *FeedEntry, htmlData []byte) (fields EntryFields, err error) {
+	fields, err = feedTar.ContentExtractor.ExtractContent(feed, entry, htmlData)
+	if nil == feedTar.FallbackExtractor || (nil == err && 0 != len(bytes.TrimSpace(fields[PATTERN_CONTENT]))) {
+		return
+	}
+	if nil != err {
+		log.Printf("[WARN] failed to extract content html %s with %s extractor, will use %s extractor: %s",
+			entry.Link, feedTar.ContentMode, feedTar.FallbackMode, err)
+	} else {
+		log.Printf("[WARN] no description extracted from %s with %s extractor, will use %s extractor",
+			entry.Link, feedTar.ContentMode, feedTar.FallbackMode)
+	}
+
+	fallbackFields, fallbackErr := feedTar.FallbackExtractor.ExtractContent(feed, entry, htmlData)
+	if nil != fallbackErr {
+		return fields, err
+	}
+	if nil == fields {
+		fields = make(EntryFields)
+	}
+	fields[PATTERN_CONTENT] = fallbackFields[PATTERN_CONTENT]
+	return fields, nil
+}
+
+// extract entries with Feed.IndexPattern and Feed.ContentPattern
+type RegexExtractor struct {
+	feedTar *FeedTarget
+}
+
+func NewRegexExtractor(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error) {
+	return &RegexExtractor{feedTar: feedTar}, nil
+}
+
+func (ext *RegexExtractor) ExtractIndex(feed *Feed, indexURL *url.URL, htmlData []byte) (entries []*FeedEntry, err error) {
+	feedTar := ext.feedTar
+	indRegs := FindIndexRegs(feedTar, indexURL)
+	for ind, indexReg := range indRegs {
+		if nil == indexReg {
+			log.Printf("[ERROR] cannot find index regex for %s", indexURL.String())
+			continue
+		}
+
+		// make a copy of source data
+		var htmlDataCopy []byte
+		if ind+1 == len(indRegs) {
+			htmlDataCopy = htmlData
+		} else {
+			htmlDataCopy = make([]byte, len(htmlData))
+			copy(htmlDataCopy, htmlData)
+		}
+
+		// filter html with index filter
+		indexFilterReg := FindIndexFilterReg(feedTar, indexReg)
+		if nil != indexFilterReg {
+			htmlDataCopy = RegexpFilter(indexFilterReg, htmlDataCopy)
+			if nil == htmlDataCopy {
+				// failed to filter htmlData
+				TraceFailedRegex(indexURL.String(), indexFilterReg, nil, htmlData, nil)
+				continue
+			}
+		}
+
+		matches := indexReg.FindAllSubmatch(htmlDataCopy, -1)
+		if nil == matches {
+			log.Printf("[ERROR] failed to match index html %s, pattern %s did not match", indexURL.String(), indexReg.String())
+			TraceFailedRegex(indexURL.String(), indexReg, indexFilterReg, htmlData, htmlDataCopy)
+			// ignore this
+			continue
+		}
+
+		for _, match := range matches {
+			entry := new(FeedEntry)
+			entry.IndexPattern = indexReg
+			for patInd, patName := range indexReg.SubexpNames() {
+				if PATTERN_CONTENT != patName {
+					SetEntryField(feedTar, feed, entry, indexURL, patName, match[patInd])
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if 0 == len(entries) {
+		err = errors.New("no index pattern matched")
+	}
+	return
+}
+
+func (ext *RegexExtractor) ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (fields EntryFields, err error) {
+	feedTar := ext.feedTar
+	contentReg := FindContentReg(feedTar, feed.URL, entry.IndexPattern)
+	if nil == contentReg {
+		return nil, errors.New("failed to find content regex")
+	}
+
+	// entries of fixtures may have no link
+	page := ""
+	if nil != entry.Link {
+		page = entry.Link.String()
+	}
+
+	// filter html with content filter
+	pageData := htmlData
+	contFilterReg := FindContentFilterReg(feedTar, contentReg)
+	if nil != contFilterReg {
+		htmlData = RegexpFilter(contFilterReg, htmlData)
+		if nil == htmlData {
+			TraceFailedRegex(page, contFilterReg, nil, pageData, nil)
+			return nil, errors.New("content filter pattern " + contFilterReg.String() + " did not match")
+		}
+	}
+
+	// extract feed entry content(description)
+	match := contentReg.FindSubmatch(htmlData)
+	if nil == match {
+		TraceFailedRegex(page, contentReg, contFilterReg, pageData, htmlData)
+		return nil, errors.New("content pattern " + contentReg.String() + " did not match")
+	}
+
+	fields = make(EntryFields)
+	for patInd, patName := range contentReg.SubexpNames() {
+		switch patName {
+		case PATTERN_CONTENT, PATTERN_PUBDATE, PATTERN_AUTHOR, PATTERN_IMAGE, PATTERN_SUMMARY:
+			fields[patName] = match[patInd]
+		case PATTERN_CATEGORY:
+			// there may be more than one {category}, join them with comma
+			if 0 != len(fields[patName]) {
+				fields[patName] = bytes.Join([][]byte{fields[patName], match[patInd]}, []byte(","))
+			} else {
+				fields[patName] = match[patInd]
+			}
+		}
+	}
+
+	return
+}
@@ -1,12 +1,112 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
 	"time"
 )
 
+// get publish date of feed entry, fall back to the date of its html cache
+func GetEntryPubDate(entry *FeedEntry) time.Time {
+	if nil != entry.PubDate {
+		return *entry.PubDate
+	} else if nil != entry.Cache.LastModified {
+		return *entry.Cache.LastModified
+	} else if nil != entry.Cache.Date {
+		return *entry.Cache.Date
+	}
+
+	log.Printf("[ERROR] entry's cache date is nil %s", entry.Link.String())
+	return time.Now()
+}
+
+// return entries which can be written to feed file
+func GetValidFeedEntries(feed *Feed) (validEntries []*FeedEntry) {
+	for entryInd, entry := range feed.Entries {
+		if nil == entry {
+			log.Printf("[ERROR] got nil entry at index %d", entryInd)
+		} else if nil == entry.Link || nil == entry.Cache {
+			log.Println("[WARN] Ignore invalid feed entry: link or cache is nil")
+		} else if 0 == len(entry.Content) {
+			log.Printf("[WARN] Ignore empty feed entry %s", entry.Link.String())
+		} else {
+			validEntries = append(validEntries, entry)
+		}
+	}
+
+	return
+}
+
+// generate a stable atom entry id from entry link, which is a name based(sha1) uuid, see rfc 4122
+func GenAtomEntryId(link string) string {
+	namespace, _ := hex.DecodeString(ATOM_UUID_URL_NAMESPACE)
+	hash := sha1.New()
+	hash.Write(namespace)
+	hash.Write([]byte(link))
+	uuid := hash.Sum(nil)[:16]
+	uuid[6] = (uuid[6] & 0x0f) | 0x50 // version 5
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // variant rfc 4122
+
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+// guess mime type of entry image from its extension
+func GuessImageType(image *url.URL) string {
+	if imageType := mime.TypeByExtension(strings.ToLower(path.Ext(image.Path))); strings.HasPrefix(imageType, "image/") {
+		return imageType
+	}
+	return DEFAULT_IMAGE_TYPE
+}
+
+func GenerateFeed(feed *Feed, format string) ([]byte, error) {
+	switch format {
+	case FEED_FORMAT_ATOM:
+		return GenerateAtomFeed(feed)
+	case FEED_FORMAT_JSON:
+		return GenerateJsonFeed(feed)
+	case FEED_FORMAT_RSS, "":
+		return GenerateRss2Feed(feed)
+	}
+
+	log.Printf("[ERROR] unknown feed format %s", format)
+	return nil, errors.New("unknown feed format " + format)
+}
+
+// save generated feed to output path, compress it with gzip if required
+func SaveFeed(output *FeedOutput, feedStr []byte) (err error) {
+	if output.Gzip {
+		var buff bytes.Buffer
+		gzipW, err := gzip.NewWriterLevel(&buff, gzip.BestCompression)
+		if nil != err {
+			log.Printf("[ERROR] failed to create gzip writer: %s", err)
+			return err
+		}
+		if _, err = gzipW.Write(feedStr); nil != err {
+			log.Printf("[ERROR] gzip failed to compress feed %s: %s", output.Path, err)
+			return err
+		}
+		if err = gzipW.Close(); nil != err {
+			log.Printf("[ERROR] gzip failed to compress feed %s: %s", output.Path, err)
+			return err
+		}
+		feedStr = buff.Bytes()
+	}
+
+	return ioutil.WriteFile(output.Path, feedStr, 0644)
+}
+
 func FeedEntryToRss2Item(entry *FeedEntry) (item Rss2Item) {
 	if nil == entry || nil == entry.Link || nil == entry.Cache {
 		log.Println("[ERROR] got invalid entry: entry is nil or entry.Link is nil or entry.Cache is nil")
@@ -16,17 +116,14 @@ func FeedEntryToRss2Item(entry *FeedEntry) (item Rss2Item) {
 	item.Title = entry.Title
 	item.Link = entry.Link.String()
 	item.Description = string(entry.Content)
-	if nil != entry.PubDate {
-		item.PubDate = entry.PubDate.Format(time.RFC1123Z)
-	} else if nil != entry.Cache.LastModified {
-		item.PubDate = entry.Cache.LastModified.Format(time.RFC1123Z)
-	} else if nil != entry.Cache.Date {
-		item.PubDate = entry.Cache.Date.Format(time.RFC1123Z)
-	} else {
-		log.Printf("[ERROR] entry's cache date is nil %s", entry.Link.String())
-		item.PubDate = time.Now().Format(time.RFC1123Z)
-	}
+	item.PubDate = GetEntryPubDate(entry).Format(time.RFC1123Z)
 	item.Guid = entry.Link.String()
+	item.Categories = entry.Categories
+	item.Creator = entry.Author
+	if nil != entry.Image {
+		item.Enclosure = &Rss2Enclosure{URL: entry.Image.String(), Type: GuessImageType(entry.Image)}
+		item.Thumbnail = &MediaThumbnail{URL: entry.Image.String()}
+	}
 
 	return
 }
@@ -47,19 +144,16 @@ func GenerateRss2Feed(feed *Feed) (rss2FeedStr []byte, err error) {
 		Generator:   GOFEED_NAME + " " + GOFEED_VERSION,
 	}
 
-	rss2Feed.Channel.Items = make([]Rss2Item, len(feed.Entries))
-	itemInd := 0
-	for entryInd, entry := range feed.Entries {
-		if nil == entry {
-			log.Printf("[ERROR] got nil entry at index %d", entryInd)
-		} else if nil == entry.Link || nil == entry.Cache {
-			log.Println("[WARN] Ignore invalid feed entry: link or cache is nil")
-		} else if 0 == len(entry.Content) {
-			log.Printf("[WARN] Ignore empty feed entry %s", entry.Link.String())
-		} else {
-			rss2Feed.Channel.Items = append(rss2Feed.Channel.Items[:itemInd], FeedEntryToRss2Item(entry))
-			itemInd += 1
+	for _, entry := range GetValidFeedEntries(feed) {
+		item := FeedEntryToRss2Item(entry)
+		// declare namespaces of the extensions only if they are used
+		if "" != item.Creator {
+			rss2Feed.XmlnsDc = DC_NAMESPACE
+		}
+		if nil != item.Thumbnail {
+			rss2Feed.XmlnsMedia = MEDIA_NAMESPACE
 		}
+		rss2Feed.Channel.Items = append(rss2Feed.Channel.Items, item)
 	}
 
 	rss2FeedStr, err = xml.MarshalIndent(rss2Feed, "  ", "    ")
@@ -69,3 +163,118 @@ func GenerateRss2Feed(feed *Feed) (rss2FeedStr []byte, err error) {
 
 	return
 }
+
+func FeedEntryToAtomEntry(entry *FeedEntry) (atomEntry AtomEntry) {
+	if nil == entry || nil == entry.Link || nil == entry.Cache {
+		log.Println("[ERROR] got invalid entry: entry is nil or entry.Link is nil or entry.Cache is nil")
+		return
+	}
+
+	pubDate := GetEntryPubDate(entry).Format(time.RFC3339)
+	atomEntry.Id = GenAtomEntryId(entry.Link.String())
+	atomEntry.Title = entry.Title
+	atomEntry.Updated = pubDate
+	atomEntry.Published = pubDate
+	atomEntry.Links = []AtomLink{AtomLink{Href: entry.Link.String(), Rel: "alternate", Type: "text/html"}}
+	if nil != entry.Image {
+		atomEntry.Links = append(atomEntry.Links, AtomLink{Href: entry.Image.String(), Rel: "enclosure", Type: GuessImageType(entry.Image)})
+	}
+	if "" != entry.Author {
+		atomEntry.Authors = []AtomPerson{AtomPerson{Name: entry.Author}}
+	}
+	for _, category := range entry.Categories {
+		atomEntry.Categories = append(atomEntry.Categories, AtomCategory{Term: category})
+	}
+	if "" != entry.Summary {
+		atomEntry.Summary = &AtomContent{Type: "html", Value: entry.Summary}
+	}
+	atomEntry.Content = AtomContent{Type: "html", Value: string(entry.Content)}
+
+	return
+}
+
+func GenerateAtomFeed(feed *Feed) (atomFeedStr []byte, err error) {
+	if nil == feed || nil == feed.URL {
+		log.Println("[ERROR] Got empty feed, wll ignore it")
+		err = errors.New("Empty feed")
+		return
+	}
+
+	atomFeed := &AtomFeed{
+		Xmlns:    ATOM_NAMESPACE,
+		Id:       feed.URL.String(),
+		Title:    feed.Title,
+		Subtitle: feed.Description,
+		Updated:  feed.LastModified.Format(time.RFC3339),
+		Links:    []AtomLink{AtomLink{Href: feed.URL.String(), Rel: "alternate", Type: "text/html"}},
+		// atom requires an author, use feed title if the site does not tell us
+		Author:    AtomPerson{Name: feed.Title, URI: feed.URL.String()},
+		Generator: AtomGenerator{URI: GOFEED_PROJECT, Version: GOFEED_VERSION, Name: GOFEED_NAME},
+	}
+
+	for _, entry := range GetValidFeedEntries(feed) {
+		atomFeed.Entries = append(atomFeed.Entries, FeedEntryToAtomEntry(entry))
+	}
+
+	atomFeedStr, err = xml.MarshalIndent(atomFeed, "  ", "    ")
+	if nil != err {
+		log.Printf("[ERROR] failed to marshal atom feed: %s", err)
+	}
+
+	return
+}
+
+func FeedEntryToJsonFeedItem(entry *FeedEntry) (item JsonFeedItem) {
+	if nil == entry || nil == entry.Link || nil == entry.Cache {
+		log.Println("[ERROR] got invalid entry: entry is nil or entry.Link is nil or entry.Cache is nil")
+		return
+	}
+
+	item.Id = entry.Link.String()
+	item.URL = entry.Link.String()
+	item.Title = entry.Title
+	item.ContentHtml = string(entry.Content)
+	item.DatePublished = GetEntryPubDate(entry).Format(time.RFC3339)
+	item.Tags = entry.Categories
+	item.Summary = entry.Summary
+	if nil != entry.Image {
+		item.Image = entry.Image.String()
+	}
+	if "" != entry.Author {
+		item.Authors = []JsonFeedAuthor{JsonFeedAuthor{Name: entry.Author}}
+	}
+
+	return
+}
+
+func GenerateJsonFeed(feed *Feed) (jsonFeedStr []byte, err error) {
+	if nil == feed || nil == feed.URL {
+		log.Println("[ERROR] Got empty feed, wll ignore it")
+		err = errors.New("Empty feed")
+		return
+	}
+
+	jsonFeed := &JsonFeed{
+		Version:     JSON_FEED_VERSION,
+		Title:       feed.Title,
+		HomePageURL: feed.URL.String(),
+		Description: feed.Description,
+		Items:       []JsonFeedItem{},
+	}
+
+	for _, entry := range GetValidFeedEntries(feed) {
+		jsonFeed.Items = append(jsonFeed.Items, FeedEntryToJsonFeedItem(entry))
+	}
+
+	// do not escape <, > and & in content_html
+	var buff bytes.Buffer
+	encoder := json.NewEncoder(&buff)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err = encoder.Encode(jsonFeed); nil != err {
+		log.Printf("[ERROR] failed to marshal json feed: %s", err)
+		return
+	}
+
+	return buff.Bytes(), nil
+}
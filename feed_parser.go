@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"golang.org/x/net/html/charset"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// extract entries from rss 2.0, rss 1.0 or atom 1.0 feeds, used for the index pages in Feed.Mode "feed"
+type FeedExtractor struct {
+	feedTar *FeedTarget
+}
+
+func NewFeedExtractor(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error) {
+	return &FeedExtractor{feedTar: feedTar}, nil
+}
+
+func ParseSourceFeed(feedData []byte) (srcFeed *SourceFeed, err error) {
+	srcFeed = new(SourceFeed)
+	decoder := xml.NewDecoder(bytes.NewReader(feedData))
+	// feeds may be encoded with gbk, gb2312, etc.
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	if err = decoder.Decode(srcFeed); nil != err {
+		return nil, err
+	}
+
+	switch strings.ToLower(srcFeed.XMLName.Local) {
+	case "rss", "rdf", "feed":
+	default:
+		return nil, errors.New("unknown feed type " + srcFeed.XMLName.Local)
+	}
+
+	return
+}
+
+// return the first non-empty string
+func FirstNonEmpty(strs ...string) string {
+	for _, str := range strs {
+		if str = strings.TrimSpace(str); "" != str {
+			return str
+		}
+	}
+	return ""
+}
+
+// whitespace and CDATA of the feed are kept
+func (ext *FeedExtractor) RawData() bool {
+	return true
+}
+
+func (ext *FeedExtractor) ExtractIndex(feed *Feed, indexURL *url.URL, htmlData []byte) (entries []*FeedEntry, err error) {
+	srcFeed, err := ParseSourceFeed(htmlData)
+	if nil != err {
+		return
+	}
+
+	feedTar := ext.feedTar
+	for _, item := range append(srcFeed.Items, srcFeed.RdfItem...) {
+		entry := &FeedEntry{Categories: item.Categories}
+		SetEntryField(feedTar, feed, entry, indexURL, PATTERN_TITLE, []byte(strings.TrimSpace(item.Title)))
+		// guid is usually the permanent link of the item
+		SetEntryField(feedTar, feed, entry, indexURL, PATTERN_LINK, []byte(FirstNonEmpty(append(item.Links, item.Guid)...)))
+		if pubDate := FirstNonEmpty(item.PubDate, item.DcDate); "" != pubDate {
+			SetEntryField(feedTar, feed, entry, indexURL, PATTERN_PUBDATE, []byte(pubDate))
+		}
+		// partial description is used if failed to extract full-text content
+		entry.Content = []byte(FirstNonEmpty(item.Content, item.Description))
+		entries = append(entries, entry)
+	}
+
+	for _, atomEntry := range srcFeed.Entries {
+		entry := new(FeedEntry)
+		SetEntryField(feedTar, feed, entry, indexURL, PATTERN_TITLE, []byte(strings.TrimSpace(atomEntry.Title)))
+		link := ""
+		for _, atomLink := range atomEntry.Links {
+			if "" == atomLink.Rel || "alternate" == atomLink.Rel {
+				link = atomLink.Href
+				break
+			}
+		}
+		SetEntryField(feedTar, feed, entry, indexURL, PATTERN_LINK, []byte(FirstNonEmpty(link, atomEntry.Id)))
+		if pubDate := FirstNonEmpty(atomEntry.Published, atomEntry.Updated); "" != pubDate {
+			SetEntryField(feedTar, feed, entry, indexURL, PATTERN_PUBDATE, []byte(pubDate))
+		}
+		for _, category := range atomEntry.Categories {
+			entry.Categories = append(entry.Categories, category.Term)
+		}
+		entry.Content = []byte(FirstNonEmpty(atomEntry.Content, atomEntry.Summary))
+		entries = append(entries, entry)
+	}
+
+	if 0 == len(entries) {
+		err = errors.New("no item found in feed")
+	} else if *gVerbose {
+		log.Printf("found %d items in feed %s", len(entries), indexURL.String())
+	}
+	return
+}
+
+func (ext *FeedExtractor) ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (EntryFields, error) {
+	return nil, errors.New("feed extractor can only be used for index pages")
+}
@@ -13,11 +13,6 @@ func RegexpFilter(filterReg *regexp.Regexp, data []byte) (outdata []byte) {
 	matches := filterReg.FindAllSubmatch(data, -1)
 	if nil == matches {
 		log.Printf("[ERROR] failed to match filter regex, pattern %s did not match", filterReg.String())
-		if *gDebug {
-			log.Println("======= debug: target data =======")
-			log.Println(string(data))
-			log.Println("==============")
-		}
 		return nil
 	}
 
@@ -31,11 +26,7 @@ func RegexpFilter(filterReg *regexp.Regexp, data []byte) (outdata []byte) {
 	}
 
 	if *gDebug {
-		log.Println("======= debug: filter regex ========")
-		log.Println(filterReg.String())
-		log.Println("======= debug: filtered data =======")
-		log.Println(string(outdata))
-		log.Println("==============")
+		log.Printf("[DEBUG] %d of %d bytes left by filter regex %s", len(outdata), len(data), filterReg.String())
 	}
 	return
 }
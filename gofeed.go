@@ -3,9 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"sync"
@@ -18,11 +18,27 @@ var (
 	gLogfile           = flag.String("l", "", "path of the log file")
 	gAlwaysUseCache    = flag.Bool("a", false, "use cache if failed to download web page")
 	gGzipCompressLevel = flag.Int("z", 9, "compression level when saving html cache with gzip in the cache database.\n\t0-9 acceptable where 0 means no compression")
+	gTraceDir          = flag.String("trace", filepath.Join(os.TempDir(), TRACE_DIR_NAME), "directory of the html trace reports of failed patterns, which are written in debug mode")
 	gVersion           = flag.Bool("version", false, "print gofeed version")
+
+	// sub commands, their names are reserved and config files of the same names should be
+	// given as ./test, etc.
+	gSubCommands = map[string]func(args []string) bool{
+		CMD_TEST:   RunTestCommand,
+		CMD_CHECK:  RunCheckCommand,
+		CMD_INDUCE: RunInduceCommand,
+		CMD_UI:     RunUICommand,
+		CMD_INIT:   RunInitCommand,
+	}
 )
 
 func showUsage() {
-	fmt.Printf("Usage %s [-version][-v][-d][-c cpu_number][-l log_file][-k][-z compression_level] json_config_file\n\n", os.Args[0])
+	fmt.Printf("Usage %s [-version][-v][-d][-c cpu_number][-l log_file][-k][-z compression_level][-trace trace_dir] json_config_file\n", os.Args[0])
+	fmt.Printf("      %s [flags] %s [test_flags] [json_config_file], see %s %s -h\n", os.Args[0], CMD_TEST, os.Args[0], CMD_TEST)
+	fmt.Printf("      %s [flags] %s [-t target] json_config_file\n", os.Args[0], CMD_CHECK)
+	fmt.Printf("      %s [flags] %s [induce_flags], see %s %s -h\n", os.Args[0], CMD_INDUCE, os.Args[0], CMD_INDUCE)
+	fmt.Printf("      %s [flags] %s [-addr address][-cache cache_db]\n", os.Args[0], CMD_UI)
+	fmt.Printf("      %s [flags] %s [-path feed_path][-cache cache_db] url\n\n", os.Args[0], CMD_INIT)
 	fmt.Printf("Flags:\n")
 	flag.PrintDefaults()
 }
@@ -38,7 +54,12 @@ func main() {
 	}
 
 	args := flag.Args()
-	if 0 == len(args) || 1 < len(args) {
+	if 0 == len(args) {
+		flag.Usage()
+		return
+	}
+	runSubCommand, isSubCommand := gSubCommands[args[0]]
+	if 1 < len(args) && !isSubCommand {
 		flag.Usage()
 		return
 	}
@@ -74,24 +95,21 @@ func main() {
 		log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 	}
 
+	// sub commands
+	if isSubCommand {
+		if !runSubCommand(args[1:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// parse json configuration first
 	feedTargets := ParseJsonConfig(args[0])
 	cacheDB := feedTargets[0].CacheDB
 
 	// create cache db if not exists
-	if _, err = os.Stat(cacheDB); nil != err && os.IsNotExist(err) {
-		log.Printf("creating cache database %s", cacheDB)
-		err = CreateDBScheme(cacheDB)
-		if nil != err {
-			log.Fatalf("[ERROR] failed to create cache database %s", cacheDB)
-		}
-	} else {
-		log.Printf("found cache database %s", cacheDB)
-		// remove expired cache entries
-		log.Printf("scanning cache db for expired entries...")
-		if feedTargets[0].CacheLifetime > 0 {
-			RemoveExpiredCache(cacheDB, feedTargets[0].CacheLifetime)
-		}
+	if err = InitCacheDB(cacheDB, feedTargets[0].CacheLifetime); nil != err {
+		log.Fatalf("[ERROR] failed to create cache database %s", cacheDB)
 	}
 
 	var wg sync.WaitGroup
@@ -108,6 +126,11 @@ func main() {
 				log.Printf("[ERROR] failed to parse feed target %s", feedTar.FeedPath)
 			}
 
+			// follow navigation steps from index pages to the article pages
+			if !ParseNavigation(feedTar, feed) {
+				log.Printf("[ERROR] failed to follow navigation steps for feed target %s", feedTar.FeedPath)
+			}
+
 			// remove duplicate entries(by link)
 			RemoveDuplicatEntries(feed)
 
@@ -122,16 +145,18 @@ func main() {
 			// sort feed entries on pubdatet desc
 			sort.Sort(sort.Reverse(FeedEntriesSortByPubDate(feed.Entries)))
 
-			// generate rss2 feed
-			rss2FeedStr, err := GenerateRss2Feed(feed)
-			if nil != err {
-				log.Printf("[ERROR] failed to generate rss %s", feedTar.FeedPath)
-			} else {
-				err = ioutil.WriteFile(feedTar.FeedPath, rss2FeedStr, 0644)
+			// generate rss2/atom/json feeds
+			for _, output := range feedTar.Outputs {
+				feedStr, err := GenerateFeed(feed, output.Format)
+				if nil != err {
+					log.Printf("[ERROR] failed to generate %s feed %s", output.Format, output.Path)
+					continue
+				}
+				err = SaveFeed(output, feedStr)
 				if nil != err {
-					log.Printf("[ERROR] failed to save feed at %s: %s", feedTar.FeedPath, err)
+					log.Printf("[ERROR] failed to save feed at %s: %s", output.Path, err)
 				} else {
-					log.Printf("[DONE] saving feed at %s", feedTar.FeedPath)
+					log.Printf("[DONE] saving feed at %s", output.Path)
 				}
 			}
 		}(feedTar)
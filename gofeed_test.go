@@ -2,11 +2,18 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -67,7 +74,7 @@ func TestParseJsonConfig(t *testing.T) {
 		t.Fatalf("%s: failed to parse index pattern, expected %s, got %s", config_file, feedIndexPattern, feedTar.IndexRegs[0].String())
 	}
 
-	feedContentPattern := `<div class="clearfix visible-xs niu2-clearfix"></div>(?P<description>(?s).*?)<div id="content-comments">`
+	feedContentPattern := `<div id="niu2-main-content">(?P<description>(?s).*?)<div id="content-comments">(?s).*?<div id="niu2-sidebar-meta"(?s).*?<div class="niu2-sidebar-value">(?P<pubdate>(?s).+?)</div>`
 	if feedContentPattern != feedTar.ContentRegs[0].String() {
 		t.Fatalf("%s: failed to parse content pattern, expected %s, got %s", config_file, feedContentPattern, feedTar.ContentRegs[0].String())
 	}
@@ -114,7 +121,7 @@ func TestFetchHtml(t *testing.T) {
 
 	// new cache
 	url, _ := url.Parse("http://blog.atime.me/agreement.html")
-	cache, err := FetchHtml(url, cacheDB, time.Duration(-1))
+	cache, err := FetchHtml(url, feedTargets[0])
 	if nil != err {
 		t.Fatalf("failed to fetch html %s", err)
 	}
@@ -139,7 +146,7 @@ func TestFetchHtml(t *testing.T) {
 	}
 
 	// use old cache
-	cache4, err := FetchHtml(url, cacheDB, time.Duration(-1))
+	cache4, err := FetchHtml(url, feedTargets[0])
 	if nil != err || CACHE_NOT_MODIFIED != cache4.Status {
 		t.Fatalf("failed to reuse html cache for %s: %s", url, err)
 	}
@@ -178,7 +185,7 @@ func TestCheckPatterns(t *testing.T) {
 func TestExtractHtmlTitle(t *testing.T) {
 	blogURL, _ := url.Parse("http://blog.atime.me")
 	cache := HtmlCache{URL: blogURL}
-	resp, err := SendHttpRequest(&cache)
+	resp, err := SendHttpRequest(&cache, 0)
 	if nil != err {
 		t.Fatalf("failed to send http request to %s", cache.URL.String())
 	}
@@ -313,6 +320,54 @@ func TestGenerateRss2Feed(t *testing.T) {
 	}
 }
 
+func TestGenerateAtomFeed(t *testing.T) {
+	feedURL, _ := url.Parse("http://blog.example.com/")
+	link, _ := url.Parse("http://blog.example.com/post/1")
+	emptyLink, _ := url.Parse("http://blog.example.com/post/2")
+	lastModified := time.Date(2014, 3, 2, 10, 0, 0, 0, GOFEED_DEFAULT_TIMEZONE)
+	pubDate := time.Date(2014, 3, 1, 10, 0, 0, 0, GOFEED_DEFAULT_TIMEZONE)
+	feed := &Feed{
+		Title:        "blog",
+		URL:          feedURL,
+		LastModified: &lastModified,
+		Entries: []*FeedEntry{
+			&FeedEntry{Title: "Post 1", Link: link, PubDate: &pubDate, Content: []byte("<p>post 1</p>"), Cache: &HtmlCache{URL: link}},
+			&FeedEntry{Title: "Post 2", Link: emptyLink, PubDate: &pubDate, Cache: &HtmlCache{URL: emptyLink}},
+		},
+	}
+
+	atomData, err := GenerateAtomFeed(feed)
+	if nil != err {
+		t.Fatalf("failed to generate atom: %s", err)
+	}
+	var atomFeed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Id      string   `xml:"id"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			Id      string `xml:"id"`
+			Title   string `xml:"title"`
+			Updated string `xml:"updated"`
+			Content string `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err = xml.Unmarshal(atomData, &atomFeed); nil != err {
+		t.Fatalf("failed to parse atom %s: %s", atomData, err)
+	}
+	if feedURL.String() != atomFeed.Id || lastModified.Format(time.RFC3339) != atomFeed.Updated {
+		t.Fatalf("wrong atom feed %s", atomData)
+	}
+	// entries without description are left out
+	if 1 != len(atomFeed.Entries) {
+		t.Fatalf("expected 1 entry, got %s", atomData)
+	}
+	entry := atomFeed.Entries[0]
+	if GenAtomEntryId(link.String()) != entry.Id || !strings.HasPrefix(entry.Id, "urn:uuid:") || "Post 1" != entry.Title ||
+		pubDate.Format(time.RFC3339) != entry.Updated || "<p>post 1</p>" != entry.Content {
+		t.Fatalf("wrong atom entry %s", atomData)
+	}
+}
+
 func TestParseIndexAndContentHtml(t *testing.T) {
 	feedTargets := ParseJsonConfig("example_config2.json")
 	cacheDB := feedTargets[0].CacheDB
@@ -347,3 +402,1406 @@ func TestParseIndexAndContentHtml(t *testing.T) {
 		}
 	}
 }
+
+func TestGenAtomEntryId(t *testing.T) {
+	// uuid5(NAMESPACE_URL, "http://www.python.org"), see python's uuid module
+	expectedId := "urn:uuid:5e077b6f-5fcc-5a59-b52a-0092db3520c3"
+	if realId := GenAtomEntryId("http://www.python.org"); expectedId != realId {
+		t.Fatalf("wrong atom entry id, expected %s, got %s", expectedId, realId)
+	}
+	if GenAtomEntryId("http://blog.atime.me") != GenAtomEntryId("http://blog.atime.me") {
+		t.Fatal("atom entry id is not stable")
+	}
+}
+
+func TestGenerateJsonFeed(t *testing.T) {
+	feedURL, _ := url.Parse("http://blog.atime.me")
+	entryURL, _ := url.Parse("http://blog.atime.me/agreement.html")
+	dateNow := time.Now()
+	feed := &Feed{
+		Title:        "mwb's blog",
+		URL:          feedURL,
+		LastModified: &dateNow,
+		Entries: []*FeedEntry{
+			&FeedEntry{Title: "agreement", Link: entryURL, Content: []byte("<p>hello world</p>"), Cache: &HtmlCache{Date: &dateNow}},
+			&FeedEntry{Title: "empty", Link: feedURL, Cache: &HtmlCache{Date: &dateNow}},
+		},
+	}
+
+	jsonFeedStr, err := GenerateJsonFeed(feed)
+	if nil != err {
+		t.Fatalf("failed to generate json feed: %s", err)
+	}
+
+	var jsonFeed JsonFeed
+	if err = json.Unmarshal(jsonFeedStr, &jsonFeed); nil != err {
+		t.Fatalf("failed to unmarshal json feed: %s", err)
+	}
+	if JSON_FEED_VERSION != jsonFeed.Version || 1 != len(jsonFeed.Items) {
+		t.Fatalf("wrong json feed %s", jsonFeedStr)
+	}
+	if entryURL.String() != jsonFeed.Items[0].Id || "<p>hello world</p>" != jsonFeed.Items[0].ContentHtml {
+		t.Fatalf("wrong json feed item %s", jsonFeedStr)
+	}
+	if !bytes.Contains(jsonFeedStr, []byte("<p>hello world</p>")) {
+		t.Fatalf("content_html should not be escaped: %s", jsonFeedStr)
+	}
+}
+
+func TestSaveFeed(t *testing.T) {
+	feedStr := []byte("<rss></rss>")
+	output := ParseFeedOutput(OutputConfig{Path: "test_output.xml.gz", Format: "RSS", Gzip: true})
+	defer os.Remove(output.Path)
+	if FEED_FORMAT_RSS != output.Format {
+		t.Fatalf("wrong output format, expected %s, got %s", FEED_FORMAT_RSS, output.Format)
+	}
+
+	if err := SaveFeed(output, feedStr); nil != err {
+		t.Fatalf("failed to save feed at %s: %s", output.Path, err)
+	}
+
+	feedFile, err := os.Open(output.Path)
+	if nil != err {
+		t.Fatalf("failed to open feed %s: %s", output.Path, err)
+	}
+	defer feedFile.Close()
+	gzipR, err := gzip.NewReader(feedFile)
+	if nil != err {
+		t.Fatalf("feed %s is not compressed: %s", output.Path, err)
+	}
+	savedFeedStr, err := ioutil.ReadAll(gzipR)
+	if nil != err || 0 != bytes.Compare(feedStr, savedFeedStr) {
+		t.Fatalf("saved feed does not match, got %s", savedFeedStr)
+	}
+}
+
+func TestXPathExtract(t *testing.T) {
+	tar := &TargetConfig{
+		URLs:         []string{"http://blog.atime.me"},
+		IndexXPath:   &ExtractRuleConfig{Entry: "//article", Title: ".//h2/a", Link: ".//h2/a/@href"},
+		ContentXPath: &ExtractRuleConfig{Description: "//div[@id='content']"},
+	}
+	if !CheckPatterns(tar) {
+		t.Fatal("check xpath rules failed")
+	}
+	feedTar := new(FeedTarget)
+	if err := CompilePatterns(feedTar, tar); nil != err {
+		t.Fatalf("failed to compile xpath rules: %s", err)
+	}
+
+	indexURL, _ := url.Parse("http://blog.atime.me/index.html")
+	indexHtml := []byte(`<html><body><article><h2><a class="title" href="/a.html"> Post A </a></h2></article>` +
+		`<article><h2><a href="http://atime.me/b.html">Post B</a></h2></article></body></html>`)
+	extractor, _ := NewXPathExtractor(feedTar, tar)
+	entries, err := extractor.ExtractIndex(new(Feed), indexURL, indexHtml)
+	if nil != err {
+		t.Fatalf("failed to extract index html with xpath: %s", err)
+	}
+	if 2 != len(entries) {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if "Post A" != entries[0].Title || "http://blog.atime.me/a.html" != entries[0].Link.String() {
+		t.Fatalf("wrong entry, title %s, link %s", entries[0].Title, entries[0].Link)
+	}
+	if "Post B" != entries[1].Title || "http://atime.me/b.html" != entries[1].Link.String() {
+		t.Fatalf("wrong entry, title %s, link %s", entries[1].Title, entries[1].Link)
+	}
+
+	contentHtml := []byte(`<html><body><div id="content"><p>hello <b>world</b></p></div></body></html>`)
+	fields, err := extractor.ExtractContent(new(Feed), entries[0], contentHtml)
+	if nil != err {
+		t.Fatalf("failed to extract content html with xpath: %s", err)
+	}
+	if "<p>hello <b>world</b></p>" != string(fields[PATTERN_CONTENT]) {
+		t.Fatalf("wrong entry content %s", fields[PATTERN_CONTENT])
+	}
+}
+
+func TestSelectorExtract(t *testing.T) {
+	tar := &TargetConfig{
+		URLs:            []string{"http://www.infzm.com"},
+		IndexSelector:   &ExtractRuleConfig{Entry: "article.post", Title: "h3 a", Link: "h3 a@href"},
+		ContentSelector: &ExtractRuleConfig{Description: "#articleContent"},
+	}
+	if !CheckPatterns(tar) {
+		t.Fatal("check css selector rules failed")
+	}
+	feedTar := new(FeedTarget)
+	if err := CompilePatterns(feedTar, tar); nil != err {
+		t.Fatalf("failed to compile css selector rules: %s", err)
+	}
+	if "href" != feedTar.IndexSelector.Link.Attr {
+		t.Fatalf("wrong attribute of css selector %s", feedTar.IndexSelector.Link.Raw)
+	}
+
+	indexURL, _ := url.Parse("http://www.infzm.com/")
+	indexHtml := []byte(`<html><body><article class="post"><section class="text"><h3><a title="a" href="/content/1">News 1</a></h3></section></article>` +
+		`<article class="ad"><h3><a href="/ad">AD</a></h3></article>` +
+		`<article class="post hot"><h3><a href="/content/2">News 2</a></h3></article></body></html>`)
+	extractor, _ := NewSelectorExtractor(feedTar, tar)
+	entries, err := extractor.ExtractIndex(new(Feed), indexURL, indexHtml)
+	if nil != err {
+		t.Fatalf("failed to extract index html with css selector: %s", err)
+	}
+	if 2 != len(entries) {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if "News 2" != entries[1].Title || "http://www.infzm.com/content/2" != entries[1].Link.String() {
+		t.Fatalf("wrong entry, title %s, link %s", entries[1].Title, entries[1].Link)
+	}
+
+	contentHtml := []byte(`<html><body><section id="articleContent"><p>hello world</p></section></body></html>`)
+	fields, err := extractor.ExtractContent(new(Feed), entries[0], contentHtml)
+	if nil != err {
+		t.Fatalf("failed to extract content html with css selector: %s", err)
+	}
+	if "<p>hello world</p>" != string(fields[PATTERN_CONTENT]) {
+		t.Fatalf("wrong entry content %s", fields[PATTERN_CONTENT])
+	}
+}
+
+type testExtractor struct{}
+
+func (ext testExtractor) ExtractIndex(feed *Feed, indexURL *url.URL, htmlData []byte) ([]*FeedEntry, error) {
+	return []*FeedEntry{&FeedEntry{Title: string(htmlData), Link: indexURL}}, nil
+}
+
+func (ext testExtractor) ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (EntryFields, error) {
+	return EntryFields{PATTERN_CONTENT: htmlData}, nil
+}
+
+func TestCreateExtractors(t *testing.T) {
+	RegisterExtractor("test", func(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error) {
+		return testExtractor{}, nil
+	})
+
+	tar := &TargetConfig{
+		URLs:            []string{"http://blog.atime.me", "http://blog.atime.me/index2.html"},
+		Mode:            "Test",
+		ContentPatterns: []string{"<div>{description}</div>"},
+	}
+	if !CheckPatterns(tar) {
+		t.Fatal("index patterns should not be required by custom extractor")
+	}
+	feedTar := new(FeedTarget)
+	if err := CreateExtractors(feedTar, tar); nil != err {
+		t.Fatalf("failed to create extractors: %s", err)
+	}
+	if "test" != feedTar.IndexMode || EXTRACTOR_PATTERN != feedTar.ContentMode {
+		t.Fatalf("wrong extractor modes %s and %s", feedTar.IndexMode, feedTar.ContentMode)
+	}
+	if _, ok := feedTar.IndexExtractor.(testExtractor); !ok {
+		t.Fatal("wrong index extractor")
+	}
+	if _, ok := feedTar.ContentExtractor.(*RegexExtractor); !ok {
+		t.Fatal("wrong content extractor")
+	}
+
+	tar = &TargetConfig{Mode: "unknown"}
+	if err := CreateExtractors(new(FeedTarget), tar); nil == err {
+		t.Fatal("should not create unknown extractor")
+	}
+	tar = &TargetConfig{Mode: EXTRACTOR_XPATH}
+	if err := CreateExtractors(new(FeedTarget), tar); nil == err {
+		t.Fatal("should not create xpath extractor without Feed.IndexXPath")
+	}
+}
+
+func TestFeedExtractor(t *testing.T) {
+	rssData := []byte(`<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>huxiu</title>` +
+		`<item><title>item 1</title><link>http://www.huxiu.com/article/1.html</link><pubDate>Mon, 17 Mar 2014 08:30:00 +0800</pubDate>` +
+		`<description><![CDATA[<p>summary</p>]]></description><category>tech</category></item>` +
+		`<item><title>item 2</title><guid>http://www.huxiu.com/article/2.html</guid></item></channel></rss>`)
+	atomData := []byte(`<feed xmlns="http://www.w3.org/2005/Atom"><title>atime</title>` +
+		`<entry><title>entry 1</title><link rel="self" href="/self"/><link href="/1.html"/><id>tag:atime.me,1</id>` +
+		`<updated>2014-03-17T08:30:00Z</updated><summary>summary</summary><category term="golang"/></entry></feed>`)
+
+	extractor, _ := NewFeedExtractor(new(FeedTarget), &TargetConfig{})
+	indexURL, _ := url.Parse("http://www.huxiu.com/rss/0.xml")
+	entries, err := extractor.ExtractIndex(new(Feed), indexURL, MinifyHtml(rssData))
+	if nil != err || 2 != len(entries) {
+		t.Fatalf("failed to extract rss items: %s", err)
+	}
+	if "item 1" != entries[0].Title || "http://www.huxiu.com/article/1.html" != entries[0].Link.String() ||
+		"<p>summary</p>" != string(entries[0].Content) || 1 != len(entries[0].Categories) {
+		t.Fatalf("wrong rss item %s %s %s", entries[0].Title, entries[0].Link, entries[0].Content)
+	}
+	if nil == entries[0].PubDate || 1395016200 != entries[0].PubDate.Unix() {
+		t.Fatalf("wrong pubdate of rss item %s", entries[0].PubDate)
+	}
+	if "http://www.huxiu.com/article/2.html" != entries[1].Link.String() {
+		t.Fatalf("guid should be used as link, got %s", entries[1].Link)
+	}
+
+	indexURL, _ = url.Parse("http://blog.atime.me/atom.xml")
+	entries, err = extractor.ExtractIndex(new(Feed), indexURL, atomData)
+	if nil != err || 1 != len(entries) {
+		t.Fatalf("failed to extract atom entries: %s", err)
+	}
+	if "http://blog.atime.me/1.html" != entries[0].Link.String() || "golang" != entries[0].Categories[0] {
+		t.Fatalf("wrong atom entry %s", entries[0].Link)
+	}
+
+	if _, err = extractor.ExtractIndex(new(Feed), indexURL, []byte("<html></html>")); nil == err {
+		t.Fatal("html should not be parsed as feed")
+	}
+
+	// the feed is not minified in the pipeline
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<rss version="2.0"><channel><item><title><![CDATA[Why x > y and a < b]]></title><link>/1</link>`+
+			`<description><![CDATA[<p>one</p> <p>two</p>]]></description></item></channel></rss>`)
+	}))
+	defer server.Close()
+	cacheDB := filepath.Join(os.TempDir(), "gofeed_feed_extractor_test.db")
+	os.Remove(cacheDB)
+	if err = CreateDBScheme(cacheDB); nil != err {
+		t.Fatalf("failed to create cache db: %s", err)
+	}
+	defer os.Remove(cacheDB)
+	feedTar, err := BuildFeedTarget(&Config{CacheDB: cacheDB}, &TargetConfig{URLs: []string{server.URL + "/rss.xml"}, Mode: EXTRACTOR_FEED})
+	if nil != err {
+		t.Fatalf("failed to build feed target: %s", err)
+	}
+	feed, _ := ParseIndexHtml(feedTar)
+	if 1 != len(feed.Entries) || "Why x > y and a < b" != feed.Entries[0].Title || "<p>one</p> <p>two</p>" != string(feed.Entries[0].Content) {
+		t.Fatalf("feed should be extracted as it is, got %+v", feed.Entries)
+	}
+}
+
+func TestJsonExtract(t *testing.T) {
+	for path, stepNum := range map[string]int{"$.data.list[*]": 3, "@['data'][-1].title": 3, "title": 1, "$": 0} {
+		jsonPath, err := CompileJsonPath(path)
+		if nil != err || stepNum != len(jsonPath.Steps) {
+			t.Fatalf("failed to compile json path %s: %s", path, err)
+		}
+	}
+	for _, path := range []string{"$..title", "$.list[", "$.list[abc]"} {
+		if _, err := CompileJsonPath(path); nil == err {
+			t.Fatalf("json path %s should be invalid", path)
+		}
+	}
+
+	// values of an object are selected in the order of keys
+	var data interface{}
+	json.Unmarshal([]byte(`{"posts": {"c": 3, "a": 1, "d": 4, "b": 2}}`), &data)
+	jsonPath, _ := CompileJsonPath("$.posts[*]")
+	for ind := 0; ind < 5; ind++ {
+		if values := jsonPath.Select(data); 4 != len(values) || "1,2,3,4" != fmt.Sprintf("%v,%v,%v,%v", values...) {
+			t.Fatalf("wrong values of object %v", values)
+		}
+	}
+
+	tar := &TargetConfig{
+		URLs:            []string{"http://www.example.com/api/articles"},
+		IndexJsonPath:   &ExtractRuleConfig{Entry: "$.data.list[*]", Title: "title", Link: "$.url", PubDate: "meta.created"},
+		ContentPatterns: []string{`<article>{description}</article>`},
+	}
+	if !CheckPatterns(tar) {
+		t.Fatal("check json path rules failed")
+	}
+	feedTar := new(FeedTarget)
+	if err := CompilePatterns(feedTar, tar); nil != err {
+		t.Fatalf("failed to compile json path rules: %s", err)
+	}
+	if err := CreateExtractors(feedTar, tar); nil != err || EXTRACTOR_JSON != feedTar.IndexMode {
+		t.Fatalf("index mode should be json, got %s: %s", feedTar.IndexMode, err)
+	}
+
+	indexURL, _ := url.Parse("http://www.example.com/api/articles")
+	jsonData := []byte(`{"code": 0, "data": {"list": [` +
+		`{"title": "article 1", "url": "/articles/1", "meta": {"created": 1395016200}},` +
+		`{"title": "article 2", "url": "http://www.example.com/articles/2", "meta": {"created": "2014-03-17T08:30:00+08:00"}}]}}`)
+	entries, err := feedTar.IndexExtractor.ExtractIndex(new(Feed), indexURL, jsonData)
+	if nil != err || 2 != len(entries) {
+		t.Fatalf("failed to extract json: %s", err)
+	}
+	if "article 1" != entries[0].Title || "http://www.example.com/articles/1" != entries[0].Link.String() {
+		t.Fatalf("wrong entry, title %s, link %s", entries[0].Title, entries[0].Link)
+	}
+	for _, entry := range entries {
+		if nil == entry.PubDate || 1395016200 != entry.PubDate.Unix() {
+			t.Fatalf("wrong pubdate %s of %s", entry.PubDate, entry.Title)
+		}
+	}
+
+	if _, err = feedTar.IndexExtractor.ExtractIndex(new(Feed), indexURL, []byte("<html></html>")); nil == err {
+		t.Fatal("html should not be parsed as json")
+	}
+
+	// json is not minified as html
+	jsonData = []byte(`{"data": {"list": [{"title": "Why x > y and a < b", "url": "/articles/3"}]}}`)
+	indexData := IndexExtractorData(feedTar, jsonData, MinifyHtml(RemoveJunkContent(jsonData)))
+	if entries, err = feedTar.IndexExtractor.ExtractIndex(new(Feed), indexURL, indexData); nil != err ||
+		1 != len(entries) || "Why x > y and a < b" != entries[0].Title {
+		t.Fatalf("json should be extracted as it is, got %v: %v", entries, err)
+	}
+}
+
+func TestSitemapExtractor(t *testing.T) {
+	sitemapData := []byte(`<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` +
+		`<url><loc>http://www.example.com/</loc><lastmod>2014-03-18</lastmod></url>` +
+		`<url><loc>http://www.example.com/article/1</loc><lastmod>2014-03-16T08:30+08:00</lastmod></url>` +
+		`<url><loc>http://www.example.com/article/2</loc><lastmod>2014-03-17T08:30:00+08:00</lastmod></url>` +
+		`<url><loc>http://www.example.com/article/3</loc></url></urlset>`)
+	var buff bytes.Buffer
+	gzipW := gzip.NewWriter(&buff)
+	gzipW.Write(sitemapData)
+	gzipW.Close()
+
+	sitemap, err := ParseSitemap(buff.Bytes())
+	if nil != err || 4 != len(sitemap.Urls) {
+		t.Fatalf("failed to parse gzip compressed sitemap: %s", err)
+	}
+
+	tar := &TargetConfig{ExtractorOptions: json.RawMessage(`{"MaxEntries": 2, "LinkPattern": "/article/\\d+"}`)}
+	extractor, err := NewSitemapExtractor(new(FeedTarget), tar)
+	if nil != err {
+		t.Fatalf("failed to create sitemap extractor: %s", err)
+	}
+	indexURL, _ := url.Parse("http://www.example.com/sitemap.xml")
+	entries, err := extractor.ExtractIndex(new(Feed), indexURL, sitemapData)
+	if nil != err || 2 != len(entries) {
+		t.Fatalf("failed to extract sitemap: %s", err)
+	}
+	// latest first
+	if "http://www.example.com/article/2" != entries[0].Link.String() || "http://www.example.com/article/1" != entries[1].Link.String() {
+		t.Fatalf("wrong entries %s, %s", entries[0].Link, entries[1].Link)
+	}
+	if nil == entries[1].PubDate || 1394929800 != entries[1].PubDate.Unix() {
+		t.Fatalf("wrong pubdate %s", entries[1].PubDate)
+	}
+
+	tar.ExtractorOptions = json.RawMessage(`{"LinkPattern": "("}`)
+	if _, err = NewSitemapExtractor(new(FeedTarget), tar); nil == err {
+		t.Fatal("invalid link pattern should be rejected")
+	}
+}
+
+func TestIndexPagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 1
+		fmt.Sscanf(r.URL.Path, "/page/%d", &page)
+		// the last page links back to the first one
+		fmt.Fprintf(w, `<html><body><h3><a href="/post/%d">Post %d</a></h3><a class="next" href="/page/%d">Next</a></body></html>`,
+			page, page, page%3+1)
+	}))
+	defer server.Close()
+
+	cacheDB := filepath.Join(os.TempDir(), "gofeed_pagination_test.db")
+	os.Remove(cacheDB)
+	if err := CreateDBScheme(cacheDB); nil != err {
+		t.Fatalf("failed to create cache db: %s", err)
+	}
+	defer os.Remove(cacheDB)
+
+	tar := &TargetConfig{
+		URLs:            []string{server.URL + "/page/1"},
+		IndexPatterns:   []string{`<h3><a href="{link}">{title}</a></h3>`},
+		ContentPatterns: []string{`<body>{description}</body>`},
+		NextPagePattern: `<a class="next" href="{link}">`,
+	}
+	if !CheckPatterns(tar) {
+		t.Fatal("check next page pattern failed")
+	}
+	tarURL, _ := url.Parse(tar.URLs[0])
+	for maxPages, entryNum := range map[int]int{1: 1, 2: 2, 5: 3} {
+		feedTar := &FeedTarget{URLs: []*url.URL{tarURL}, CacheDB: cacheDB, MaxPages: maxPages}
+		if err := CompilePatterns(feedTar, tar); nil != err {
+			t.Fatalf("failed to compile patterns: %s", err)
+		}
+		CreateExtractors(feedTar, tar)
+
+		feed, _ := ParseIndexHtml(feedTar)
+		if entryNum != len(feed.Entries) {
+			t.Fatalf("expected %d entries with %d pages, got %d", entryNum, maxPages, len(feed.Entries))
+		}
+		if 1 < entryNum && server.URL+"/post/2" != feed.Entries[1].Link.String() {
+			t.Fatalf("wrong entry link %s", feed.Entries[1].Link)
+		}
+	}
+
+	tar.NextPagePattern = `<a class="next">`
+	if CheckPatterns(tar) {
+		t.Fatal("next page pattern without {link} should be invalid")
+	}
+}
+
+func TestContentPagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 1
+		fmt.Sscanf(r.URL.Path, "/news/1_%d.html", &page)
+		// the last page links back to the first one
+		nextPage := fmt.Sprintf("/news/1_%d.html", page+1)
+		if 3 == page {
+			nextPage = "/news/1.html"
+		}
+		fmt.Fprintf(w, `<html><body><div id="content"><p>page %d</p></div><a class="next" href="%s">Next</a></body></html>`, page, nextPage)
+	}))
+	defer server.Close()
+
+	cacheDB := filepath.Join(os.TempDir(), "gofeed_content_pagination_test.db")
+	os.Remove(cacheDB)
+	if err := CreateDBScheme(cacheDB); nil != err {
+		t.Fatalf("failed to create cache db: %s", err)
+	}
+	defer os.Remove(cacheDB)
+
+	tar := &TargetConfig{
+		URLs:                   []string{server.URL},
+		IndexPatterns:          []string{`<a href="{link}">{title}</a>`},
+		ContentPatterns:        []string{`<div id="content">{description}</div>`},
+		ContentNextPagePattern: `<a class="next" href="{link}">`,
+	}
+	if !CheckPatterns(tar) {
+		t.Fatal("check content next page pattern failed")
+	}
+	for maxPages, content := range map[int]string{1: "<p>page 1</p>", 2: "<p>page 1</p><p>page 2</p>", 10: "<p>page 1</p><p>page 2</p><p>page 3</p>"} {
+		feedTar := &FeedTarget{CacheDB: cacheDB, ContentMaxPages: maxPages}
+		if err := CompilePatterns(feedTar, tar); nil != err {
+			t.Fatalf("failed to compile patterns: %s", err)
+		}
+		CreateExtractors(feedTar, tar)
+
+		link, _ := url.Parse(server.URL + "/news/1.html")
+		feed := &Feed{Entries: []*FeedEntry{&FeedEntry{Title: "news", Link: link}}}
+		ParseContentHtml(feedTar, feed)
+		if 1 != len(feed.Entries) || content != string(feed.Entries[0].Content) {
+			t.Fatalf("wrong content with %d pages: %s", maxPages, feed.Entries[0].Content)
+		}
+	}
+}
+
+func TestParseNavigation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case "/" == r.URL.Path:
+			fmt.Fprint(w, `<html><body><a class="cat" href="/cat/1">Cat 1</a><a class="cat" href="/cat/2">Cat 2</a><a class="cat" href="/cat/1">Cat 1</a></body></html>`)
+		case strings.HasPrefix(r.URL.Path, "/cat/"):
+			fmt.Fprintf(w, `<html><body><a href="/ad">AD</a><ul><li><a href="/go?to=%[1]s-1">Post %[1]s-1</a></li><li><a href="/go?to=%[1]s-2">Post %[1]s-2</a></li></ul></body></html>`,
+				strings.TrimPrefix(r.URL.Path, "/cat/"))
+		case "/go" == r.URL.Path:
+			fmt.Fprintf(w, `<html><body>redirecting<a id="continue" href="/post/%s">continue</a></body></html>`, r.URL.Query().Get("to"))
+		}
+	}))
+	defer server.Close()
+
+	cacheDB := filepath.Join(os.TempDir(), "gofeed_navigation_test.db")
+	os.Remove(cacheDB)
+	if err := CreateDBScheme(cacheDB); nil != err {
+		t.Fatalf("failed to create cache db: %s", err)
+	}
+	defer os.Remove(cacheDB)
+
+	tar := &TargetConfig{
+		URLs:            []string{server.URL + "/"},
+		IndexPatterns:   []string{`<a class="cat" href="{link}">{title}</a>`},
+		ContentPatterns: []string{`<body>{description}</body>`},
+		Navigation: []NavigationConfig{
+			NavigationConfig{Pattern: `<li><a href="{link}">{title}</a></li>`, FilterPattern: `<ul>{filter}</ul>`},
+			NavigationConfig{Pattern: `<a id="continue" href="{link}">`},
+		},
+	}
+	if !CheckPatterns(tar) {
+		t.Fatal("check navigation patterns failed")
+	}
+	tarURL, _ := url.Parse(tar.URLs[0])
+	feedTar := &FeedTarget{URLs: []*url.URL{tarURL}, CacheDB: cacheDB}
+	if err := CompilePatterns(feedTar, tar); nil != err {
+		t.Fatalf("failed to compile patterns: %s", err)
+	}
+	CreateExtractors(feedTar, tar)
+
+	feed, _ := ParseIndexHtml(feedTar)
+	if !ParseNavigation(feedTar, feed) || 4 != len(feed.Entries) {
+		t.Fatalf("expected 4 articles, got %d", len(feed.Entries))
+	}
+	entry := feed.Entries[3]
+	if server.URL+"/post/2-2" != entry.Link.String() || "Post 2-2" != entry.Title || feedTar.IndexRegs[0] != entry.IndexPattern {
+		t.Fatalf("wrong article, title %s, link %s", entry.Title, entry.Link)
+	}
+
+	tar.Navigation = []NavigationConfig{NavigationConfig{Pattern: `<a href="{link}">{description}</a>`}}
+	if CheckPatterns(tar) {
+		t.Fatal("navigation pattern with {description} should be invalid")
+	}
+}
+
+func TestExpandURLTemplates(t *testing.T) {
+	now := time.Date(2014, 3, 1, 10, 0, 0, 0, GOFEED_DEFAULT_TIMEZONE)
+	urls, err := ExpandURLTemplate("http://example.com/news/{yyyy}/{mm}/{dd}/list_{1..2}.html", 1, now)
+	if nil != err {
+		t.Fatalf("failed to expand url template: %s", err)
+	}
+	expected := []string{
+		"http://example.com/news/2014/03/01/list_1.html",
+		"http://example.com/news/2014/03/01/list_2.html",
+		"http://example.com/news/2014/02/28/list_1.html",
+		"http://example.com/news/2014/02/28/list_2.html",
+	}
+	if len(expected) != len(urls) {
+		t.Fatalf("expected %d urls, got %v", len(expected), urls)
+	}
+	for i := range expected {
+		if expected[i] != urls[i] {
+			t.Fatalf("expected %s, got %s", expected[i], urls[i])
+		}
+	}
+
+	// same month, padded numbers
+	urls, _ = ExpandURLTemplate("http://example.com/{yyyy}{mm}/p{08..10}", 3, time.Date(2014, 3, 10, 0, 0, 0, 0, GOFEED_DEFAULT_TIMEZONE))
+	if 3 != len(urls) || "http://example.com/201403/p08" != urls[0] || "http://example.com/201403/p10" != urls[2] {
+		t.Fatalf("wrong urls %v", urls)
+	}
+	for _, rawURL := range []string{"http://example.com/{5..1}", "http://example.com/{1..1000}"} {
+		if _, err = ExpandURLTemplate(rawURL, 0, now); nil == err {
+			t.Fatalf("url template %s should be invalid", rawURL)
+		}
+	}
+	if _, err = ExpandURLTemplate("http://example.com/{yyyy}/{mm}/{dd}/", 365, now); nil == err {
+		t.Fatal("url template of 366 days should be invalid")
+	}
+	if urls, err = ExpandURLTemplate("http://example.com/{yyyy}/{mm}/{dd}/", URL_TEMPLATE_MAX_URLS-1, now); nil != err || URL_TEMPLATE_MAX_URLS != len(urls) {
+		t.Fatalf("expected %d urls, got %d, %v", URL_TEMPLATE_MAX_URLS, len(urls), err)
+	}
+
+	tar := &TargetConfig{
+		URLs:            []string{"http://a.com/{1..3}.html", "http://b.com/"},
+		IndexPatterns:   []string{"a {title}{link}", "b {title}{link}"},
+		ContentPatterns: []string{"{description}"},
+	}
+	urls, urlInds, err := ExpandURLTemplates(tar, now)
+	if nil != err || 4 != len(urls) || "0 0 0 1" != strings.Trim(fmt.Sprint(urlInds), "[]") {
+		t.Fatalf("failed to expand url templates: %v %v %v", urls, urlInds, err)
+	}
+	feedTar, err := BuildFeedTarget(&Config{}, tar)
+	if nil != err || 4 != len(feedTar.URLs) {
+		t.Fatalf("failed to build feed target: %s", err)
+	}
+	if indexRegs := FindIndexRegs(feedTar, feedTar.URLs[2]); 1 != len(indexRegs) || feedTar.IndexRegs[0] != indexRegs[0] {
+		t.Fatalf("wrong index patterns %v of %s", indexRegs, feedTar.URLs[2])
+	}
+	if indexRegs := FindIndexRegs(feedTar, feedTar.URLs[3]); 1 != len(indexRegs) || feedTar.IndexRegs[1] != indexRegs[0] {
+		t.Fatalf("wrong index patterns %v of %s", indexRegs, feedTar.URLs[3])
+	}
+
+	// all the patterns of a single url template are used by its urls, the same as a single url
+	tar = &TargetConfig{
+		URLs:            []string{"http://a.com/{1..3}.html"},
+		IndexPatterns:   []string{"a {title}{link}", "b {title}{link}"},
+		ContentPatterns: []string{"a {description}", "b {description}"},
+	}
+	if feedTar, err = BuildFeedTarget(&Config{}, tar); nil != err {
+		t.Fatalf("failed to build feed target: %s", err)
+	}
+	if 2 != len(FindIndexRegs(feedTar, feedTar.URLs[1])) ||
+		feedTar.ContentRegs[1] != FindContentReg(feedTar, feedTar.URLs[1], feedTar.IndexRegs[1]) {
+		t.Fatalf("patterns should be shared by the urls of %s", tar.URLs[0])
+	}
+}
+
+func TestCustomFields(t *testing.T) {
+	tar := &TargetConfig{
+		URLs:            []string{"http://blog.atime.me"},
+		IndexPatterns:   []string{`<h2><a href="{link}">{title}</a></h2><img src="{image}">`},
+		ContentPatterns: []string{`<span class="author">{writer}</span>{any}<a rel="tag">{category}</a><a rel="tag">{category}</a><p class="summary">{summary}</p><div>{description}</div>`},
+		Fields:          map[string]string{"writer": PATTERN_AUTHOR},
+	}
+	if !CheckPatterns(tar) {
+		t.Fatal("check custom fields failed")
+	}
+	feedTar := new(FeedTarget)
+	if err := CompilePatterns(feedTar, tar); nil != err {
+		t.Fatalf("failed to compile patterns: %s", err)
+	}
+	CreateExtractors(feedTar, tar)
+
+	feedURL, _ := url.Parse("http://blog.atime.me")
+	feed := &Feed{Title: "mwb's blog", URL: feedURL}
+	entries, err := feedTar.IndexExtractor.ExtractIndex(feed, feedURL, []byte(`<h2><a href="/post/1.html">Post 1</a></h2><img src="/images/1.png">`))
+	if nil != err || 1 != len(entries) {
+		t.Fatalf("failed to extract index html: %s", err)
+	}
+	entry := entries[0]
+	if nil == entry.Image || "http://blog.atime.me/images/1.png" != entry.Image.String() {
+		t.Fatalf("wrong entry image %s", entry.Image)
+	}
+
+	fields, err := feedTar.ContentExtractor.ExtractContent(feed, entry, []byte(`<span class="author">mwb</span><br>`+
+		`<a rel="tag">golang</a><a rel="tag">rss, atom</a><p class="summary">hello</p><div>hello world</div>`))
+	if nil != err {
+		t.Fatalf("failed to extract content html: %s", err)
+	}
+	for fieldName, value := range fields {
+		SetEntryField(feedTar, feed, entry, entry.Link, fieldName, value)
+	}
+	if "mwb" != entry.Author || "hello" != entry.Summary || 3 != len(entry.Categories) || "atom" != entry.Categories[2] {
+		t.Fatalf("wrong custom fields, author %s, summary %s, categories %v", entry.Author, entry.Summary, entry.Categories)
+	}
+
+	dateNow := time.Now()
+	feed.LastModified = &dateNow
+	entry.Cache = &HtmlCache{Date: &dateNow}
+	feed.Entries = entries
+	for format, expected := range map[string][]string{
+		FEED_FORMAT_RSS:  []string{`xmlns:dc="` + DC_NAMESPACE, `<dc:creator>mwb</dc:creator>`, `<enclosure url="http://blog.atime.me/images/1.png" length="0" type="image/png">`, `<media:thumbnail url="http://blog.atime.me/images/1.png">`},
+		FEED_FORMAT_ATOM: []string{`<name>mwb</name>`, `<link href="http://blog.atime.me/images/1.png" rel="enclosure" type="image/png">`, `<summary type="html">hello</summary>`},
+		FEED_FORMAT_JSON: []string{`"summary": "hello"`, `"image": "http://blog.atime.me/images/1.png"`, `"name": "mwb"`},
+	} {
+		feedStr, err := GenerateFeed(feed, format)
+		if nil != err {
+			t.Fatalf("failed to generate %s feed: %s", format, err)
+		}
+		for _, str := range expected {
+			if !bytes.Contains(feedStr, []byte(str)) {
+				t.Fatalf("%s feed should contain %s: %s", format, str, feedStr)
+			}
+		}
+	}
+
+	for _, fields := range []map[string]string{{"title": PATTERN_AUTHOR}, {"writer": PATTERN_TITLE}, {"a-b": PATTERN_AUTHOR}} {
+		if CheckCustomFields(fields) {
+			t.Fatalf("custom fields %v should be invalid", fields)
+		}
+	}
+}
+
+func TestTokenizePattern(t *testing.T) {
+	tokens, err := TokenizePattern(`<a{attr:href:link}>{title}</a>[[<em>{int}</em>||<b>]]{2}`)
+	if nil != err {
+		t.Fatalf("failed to tokenize pattern: %s", err)
+	}
+	expected := []PatternToken{
+		PatternToken{Type: PATTERN_TOKEN_TEXT, Pos: 0, Text: "<a"},
+		PatternToken{Type: PATTERN_TOKEN_ATTR, Pos: 2, Text: "{attr:href:link}", Name: "href", Field: "link"},
+		PatternToken{Type: PATTERN_TOKEN_TEXT, Pos: 18, Text: ">"},
+		PatternToken{Type: PATTERN_TOKEN_FIELD, Pos: 19, Text: "{title}", Name: "title"},
+		PatternToken{Type: PATTERN_TOKEN_TEXT, Pos: 26, Text: "</a>"},
+		PatternToken{Type: PATTERN_TOKEN_OPTIONAL_START, Pos: 30, Text: "[["},
+		PatternToken{Type: PATTERN_TOKEN_TEXT, Pos: 32, Text: "<em>"},
+		PatternToken{Type: PATTERN_TOKEN_FIELD, Pos: 36, Text: "{int}", Name: "int"},
+		PatternToken{Type: PATTERN_TOKEN_TEXT, Pos: 41, Text: "</em>"},
+		PatternToken{Type: PATTERN_TOKEN_ALTERNATIVE, Pos: 46, Text: "||"},
+		PatternToken{Type: PATTERN_TOKEN_TEXT, Pos: 48, Text: "<b>"},
+		PatternToken{Type: PATTERN_TOKEN_OPTIONAL_END, Pos: 51, Text: "]]"},
+		PatternToken{Type: PATTERN_TOKEN_TEXT, Pos: 53, Text: "{2}"},
+	}
+	if len(expected) != len(tokens) {
+		t.Fatalf("expected %d tokens, got %v", len(expected), tokens)
+	}
+	for i := range expected {
+		if expected[i] != tokens[i] {
+			t.Fatalf("expected token %v, got %v", expected[i], tokens[i])
+		}
+	}
+
+	// ]] of CDATA and posix class are not tokens
+	for _, pat := range []string{"<title><![CDATA[{title}]]></title>", "[[:alpha:]]+{link}"} {
+		if tokens, err = TokenizePattern(pat); nil != err {
+			t.Fatalf("failed to tokenize %s: %s", pat, err)
+		}
+		for _, token := range tokens {
+			if PATTERN_TOKEN_TEXT != token.Type && PATTERN_TOKEN_FIELD != token.Type {
+				t.Fatalf("wrong tokens of %s: %v", pat, tokens)
+			}
+		}
+	}
+	for _, pat := range []string{"[[<b>", "[[<b>[[</b>]]", "{attr:}", "{attr:a b}", "{attr:href:link:title}"} {
+		if _, err = TokenizePattern(pat); nil == err {
+			t.Fatalf("pattern %s should be invalid", pat)
+		}
+	}
+
+	indexReg, err := CompilePattern(`<li{attr:class}>{ws}<a{attr:href:link}>{text}</a>[[<span>{title}</span>||<b>{title}</b>]]<i>{int}[[ views]]</i>`, nil)
+	if nil != err {
+		t.Fatalf("failed to compile pattern: %s", err)
+	}
+	htmlData := `<li class="post hot"> <a id="1" href='/post/1' target="_blank">Post 1</a><b>Post 1</b><i>120 views</i></li>` +
+		`<li class="post"><a href="/post/2">Post 2</a><span>Post 2</span><i>3</i></li>`
+	matches := indexReg.FindAllStringSubmatch(htmlData, -1)
+	if 2 != len(matches) {
+		t.Fatalf("expected 2 matches, got %v", matches)
+	}
+	if "/post/1" != matches[0][indexReg.SubexpIndex(PATTERN_LINK)] || "/post/2" != matches[1][indexReg.SubexpIndex(PATTERN_LINK)] {
+		t.Fatalf("wrong links %v", matches)
+	}
+
+	if 2 != CountPatternField(`<a{attr:href:link}>{link}`, PATTERN_LINK) || -1 != CountPatternField(`[[{link}`, PATTERN_LINK) {
+		t.Fatal("wrong number of link fields")
+	}
+	if !CheckPatterns(&TargetConfig{IndexPatterns: []string{`<a{attr:href:link}>{title}</a>`}, ContentPatterns: []string{`{description}`}}) {
+		t.Fatal("{attr:href:link} should be counted as {link}")
+	}
+}
+
+func TestLintPatterns(t *testing.T) {
+	tar := &TargetConfig{
+		Title:         "lint",
+		URLs:          []string{"http://example.com"},
+		IndexPatterns: []string{`{any}<a href="{link}">{title}</a>{foo}{any}`},
+		ContentPatterns: []string{
+			`<div>{description}</div>[[<b>{author}</b>||<i>{author}</i>]]<span>{writer}</span><em>{author}</em>`,
+		},
+		PubDatePatterns: []string{"{year}-{month} {title}"},
+		Fields:          map[string]string{"writer": PATTERN_AUTHOR},
+	}
+
+	expected := []PatternIssue{
+		PatternIssue{LINT_WARN, "lint", "Feed.IndexPattern[0]", 0, ""},
+		PatternIssue{LINT_WARN, "lint", "Feed.IndexPattern[0]", 38, ""},
+		PatternIssue{LINT_WARN, "lint", "Feed.IndexPattern[0]", 33, ""},
+		PatternIssue{LINT_WARN, "lint", "Feed.ContentPattern[0]", 85, ""},
+		PatternIssue{LINT_WARN, "lint", "Feed.PubDatePattern[0]", -1, ""},
+		PatternIssue{LINT_WARN, "lint", "Feed.PubDatePattern[0]", 15, ""},
+	}
+	issues := LintPatterns(tar)
+	if len(expected) != len(issues) {
+		t.Fatalf("expected %d issues, got %v", len(expected), issues)
+	}
+	for ind, issue := range issues {
+		issue.Message = ""
+		if expected[ind] != issue {
+			t.Fatalf("expected issue %v, got %v", expected[ind], issues[ind])
+		}
+	}
+	if !LogPatternIssues(issues) || LogPatternIssues(append(issues, newPatternIssue(LINT_ERROR, "Feed.IndexPattern[0]", -1, "error"))) {
+		t.Fatal("only errors should fail the lint")
+	}
+
+	issues = LintPattern("Feed.IndexPattern[1]", `<a href="{link}">[[<b>{title}</a>`, nil)
+	if 1 != len(issues) || LINT_ERROR != issues[0].Level || 17 != issues[0].Pos {
+		t.Fatalf("unclosed block should be reported at 17, got %v", issues)
+	}
+	issues = LintPattern("Feed.IndexPattern[2]", `<b>+*{title}</b><a href="{link}">`, nil)
+	if 1 != len(issues) || 3 != issues[0].Pos {
+		t.Fatalf("invalid regex should be reported at 3, got %v", issues)
+	}
+	// the same regex is valid in the former text
+	issues = LintPattern("Feed.IndexPattern[3]", `<i>\+*</i>{title}<b>+*</b><a href="{link}">`, nil)
+	if 1 != len(issues) || 20 != issues[0].Pos {
+		t.Fatalf("invalid regex should be reported at 20, got %v", issues)
+	}
+	issues = LintPattern("Feed.IndexPattern[4]", `<a href="{link}">({title}</a>`, nil)
+	if 1 != len(issues) || -1 != issues[0].Pos {
+		t.Fatalf("unclosed group should be reported without offset, got %v", issues)
+	}
+
+	tar = &TargetConfig{URLs: []string{"http://example.com"}, IndexPatterns: []string{`<a href="{link}">{title}</a>`}}
+	if issues = LintContentRules(tar); 1 != len(issues) || LINT_ERROR != issues[0].Level || "Feed.ContentPattern" != issues[0].Key {
+		t.Fatalf("missing content pattern should be an error, got %v", issues)
+	}
+	tar.ContentFallback = EXTRACTOR_READABILITY
+	if issues = LintContentRules(tar); 0 != len(issues) {
+		t.Fatalf("content fallback should replace the content pattern, got %v", issues)
+	}
+}
+
+func TestRunTargetTest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><a href="/ad">AD</a><ul><li><a href="/post/1">Post 1</a></li><li><a href="/post/2">Post 2</a></li></ul></body></html>`)
+		case "/post/1":
+			fmt.Fprint(w, `<html><body><div id="content">post 1</div></body></html>`)
+		default:
+			fmt.Fprint(w, `<html><body>not found</body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	cacheDB := filepath.Join(os.TempDir(), "gofeed_run_target_test.db")
+	os.Remove(cacheDB)
+	if err := CreateDBScheme(cacheDB); nil != err {
+		t.Fatalf("failed to create cache db: %s", err)
+	}
+	defer os.Remove(cacheDB)
+
+	tar := &TargetConfig{
+		Title:               "test",
+		URLs:                []string{server.URL + "/"},
+		IndexPatterns:       []string{`<li><a href="{link}">{title}</a></li>`},
+		IndexFilterPatterns: []string{`<ul>{filter}</ul>`},
+		ContentPatterns:     []string{`<div id="content">{description}</div>`},
+	}
+	feedTar, err := BuildFeedTarget(&Config{CacheDB: cacheDB}, tar)
+	if nil != err {
+		t.Fatalf("failed to build feed target: %s", err)
+	}
+
+	feed, steps := RunTargetTest(feedTar, "", "", TEST_MAX_ENTRIES, true)
+	expected := []TestStep{
+		TestStep{"filter", "Feed.IndexFilterPattern[0]", server.URL + "/", "", false, ""},
+		TestStep{"index", "Feed.IndexPattern[0]", server.URL + "/", "2 matches", false, ""},
+		TestStep{"content", "Feed.ContentPattern[0]", server.URL + "/post/1", "1 matches", false, ""},
+		TestStep{"content", "Feed.ContentPattern[0]", server.URL + "/post/2", "did not match", true, ""},
+	}
+	if len(expected) != len(steps) {
+		t.Fatalf("expected %d steps, got %v", len(expected), steps)
+	}
+	for ind, step := range steps {
+		if "filter" == step.Step {
+			step.Result = ""
+		}
+		step.Trace = ""
+		if expected[ind] != step {
+			t.Fatalf("expected step %v, got %v", expected[ind], steps[ind])
+		}
+	}
+	if "" == steps[3].Trace {
+		t.Fatal("trace report of the failed step should be written")
+	}
+	defer os.Remove(steps[3].Trace)
+	if 2 != len(feed.Entries) || "post 1" != string(feed.Entries[0].Content) || 0 != len(feed.Entries[1].Content) {
+		t.Fatalf("wrong entries %v", feed.Entries)
+	}
+
+	var out bytes.Buffer
+	PrintTestResult(&out, feed, steps)
+	if !strings.Contains(out.String(), "FAILED: did not match") || !strings.Contains(out.String(), "Post 2") {
+		t.Fatalf("wrong test result:\n%s", out.String())
+	}
+
+	// index pattern matches nothing
+	tar.IndexPatterns = []string{`<h3><a href="{link}">{title}</a></h3>`}
+	tar.IndexFilterPatterns = nil
+	if feedTar, err = BuildFeedTarget(&Config{CacheDB: cacheDB}, tar); nil != err {
+		t.Fatalf("failed to build feed target: %s", err)
+	}
+	feed, steps = RunTargetTest(feedTar, "", "", TEST_MAX_ENTRIES, true)
+	for _, step := range steps {
+		defer os.Remove(step.Trace)
+	}
+	if 0 != len(feed.Entries) || 1 != len(steps) || !steps[0].Failed {
+		t.Fatalf("no entries should be extracted, got %v, steps %v", feed.Entries, steps)
+	}
+	out.Reset()
+	PrintTestResult(&out, feed, steps)
+	if !strings.Contains(out.String(), "0 entries") {
+		t.Fatalf("wrong test result:\n%s", out.String())
+	}
+}
+
+// content pattern is optional in the command line
+func TestRunTestCommand(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><ul><li><a href="/post/1">Post 1</a></li><li><a href="/post/2">Post 2</a></li></ul></body></html>`)
+		default:
+			fmt.Fprint(w, `<html><body><div id="content">post</div></body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	cacheDB := filepath.Join(os.TempDir(), "gofeed_test_command_test.db")
+	os.Remove(cacheDB)
+	defer os.Remove(cacheDB)
+
+	// the test result is printed to stdout
+	outFile, err := ioutil.TempFile("", "gofeed_test_command")
+	if nil != err {
+		t.Fatalf("failed to create temp file: %s", err)
+	}
+	defer os.Remove(outFile.Name())
+	stdout := os.Stdout
+	os.Stdout = outFile
+	ok := RunTestCommand([]string{"-url", server.URL + "/", "-index", `<li><a href="{link}">{title}</a></li>`, "-cache", cacheDB})
+	os.Stdout = stdout
+	outFile.Close()
+
+	out, err := ioutil.ReadFile(outFile.Name())
+	if nil != err {
+		t.Fatalf("failed to read test result: %s", err)
+	}
+	if !ok || 2 != strings.Count(string(out), "not defined, skipped") {
+		t.Fatalf("content pages should be skipped without -content:\n%s", out)
+	}
+}
+
+func TestTraceRegex(t *testing.T) {
+	reg, err := CompilePattern(`<li><a href="{link}">{title}</a></li>`, nil)
+	if nil != err {
+		t.Fatalf("failed to compile pattern: %s", err)
+	}
+	pageData := []byte(`<div><ul><li><a href="/1">One</a></ul></div>`)
+	trace := TraceRegex(reg, pageData)
+	if !strings.HasSuffix(trace.Regex[:trace.MatchedLen], "</a></") || 9 != trace.MatchStart || 35 != trace.MatchEnd {
+		t.Fatalf("wrong trace %s at %d-%d", trace.Regex[:trace.MatchedLen], trace.MatchStart, trace.MatchEnd)
+	}
+
+	traceDir := filepath.Join(os.TempDir(), "gofeed_trace_test")
+	os.RemoveAll(traceDir)
+	defer os.RemoveAll(traceDir)
+	*gTraceDir = traceDir
+
+	filterReg, _ := CompilePattern(`<ul>{filter}</ul>`, nil)
+	path, err := WriteTraceReport("http://example.com", reg, filterReg, pageData, RegexpFilter(filterReg, pageData))
+	if nil != err {
+		t.Fatalf("failed to write trace report: %s", err)
+	}
+	report, err := ioutil.ReadFile(path)
+	if nil != err {
+		t.Fatalf("failed to read trace report: %s", err)
+	}
+	for _, str := range []string{
+		`<span class="filtered">&lt;li&gt;&lt;a href=&#34;/1&#34;&gt;One&lt;/a&gt;</span>`,
+		`<span class="matched">&lt;li&gt;&lt;a href=&#34;/1&#34;&gt;One&lt;/a&gt;</span><span id="break" class="break"></span>`,
+		`offset 24`,
+	} {
+		if !strings.Contains(string(report), str) {
+			t.Fatalf("trace report should contain %s:\n%s", str, report)
+		}
+	}
+}
+
+func TestCheckFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofeed_check_fixtures")
+	if nil != err {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(`<html><body><ul><li><a href="/post/1">Post &amp; 1</a></li><li><a href="post/2">Post 2</a></li></ul></body></html>`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "post.html"), []byte(`<html><body><div id="content"> post 1 content</div></body></html>`), 0644)
+
+	tar := &TargetConfig{
+		Title:           "test",
+		URLs:            []string{"http://blog.example.com/"},
+		IndexPatterns:   []string{`<li><a href="{link}">{title}</a></li>`},
+		ContentPatterns: []string{`<div id="content">{description}</div>`},
+	}
+	feedTar, err := BuildFeedTarget(&Config{CacheDB: filepath.Join(dir, "cache.db")}, tar)
+	if nil != err {
+		t.Fatalf("failed to build feed target: %s", err)
+	}
+
+	fixtures := []FixtureConfig{
+		FixtureConfig{
+			IndexFile:   "index.html",
+			Titles:      []string{"Post & 1", "Post 2"},
+			Links:       []string{"/post/1", "http://blog.example.com/post/2"},
+			ContentFile: "post.html",
+			Description: "post 1",
+		},
+		FixtureConfig{
+			URL:         "http://blog.example.com/page/2",
+			IndexFile:   "index.html",
+			Titles:      []string{"Post & 1", "Post 3"},
+			ContentFile: "post.html",
+			Description: "post 2",
+		},
+		FixtureConfig{IndexFile: "missing.html"},
+		FixtureConfig{Description: "post"},
+	}
+	steps := CheckFixtures(feedTar, fixtures, dir)
+	expected := []TestStep{
+		TestStep{"index", "Feed.Tests[0]", "index.html", "2 entries", false, ""},
+		TestStep{"content", "Feed.Tests[0]", "post.html", "14 bytes", false, ""},
+		TestStep{"index", "Feed.Tests[1]", "index.html", `entry 2: expected title "Post 3", got "Post 2"`, true, ""},
+		TestStep{"content", "Feed.Tests[1]", "post.html", `expected description "post 2", got "post 1 content"`, true, ""},
+	}
+	if len(expected)+2 != len(steps) {
+		t.Fatalf("expected %d steps, got %v", len(expected)+2, steps)
+	}
+	for ind, step := range expected {
+		if step != steps[ind] {
+			t.Fatalf("expected step %v, got %v", step, steps[ind])
+		}
+	}
+	for _, step := range steps[len(expected):] {
+		if !step.Failed {
+			t.Fatalf("invalid fixture should fail, got %v", step)
+		}
+	}
+
+	// xpath rules keep the entries without link, the content pattern fails on them
+	tar = &TargetConfig{
+		URLs:            []string{"http://blog.example.com/"},
+		IndexXPath:      &ExtractRuleConfig{Entry: "//li", Title: "./a", Link: "./a/@data-href"},
+		ContentPatterns: []string{`<div id="missing">{description}</div>`},
+	}
+	if feedTar, err = BuildFeedTarget(&Config{CacheDB: filepath.Join(dir, "cache.db")}, tar); nil != err {
+		t.Fatalf("failed to build feed target: %s", err)
+	}
+	steps = CheckFixtures(feedTar, []FixtureConfig{FixtureConfig{IndexFile: "index.html", ContentFile: "post.html"}}, dir)
+	if 2 != len(steps) || !steps[1].Failed {
+		t.Fatalf("content pattern should fail, got %v", steps)
+	}
+}
+
+func TestInducePatterns(t *testing.T) {
+	indexHtml := MinifyHtml([]byte(`<html><body>
+		<div class="sidebar"><ul><li><a href="/about">About</a></li><li><a href="/archive">Archive</a></li></ul></div>
+		<div class="posts">
+			<h2 class="title"><a href="/post/1.html" id="p1">First post</a></h2><span class="date">2020-01-01</span>
+			<h2 class="title"><a href="/post/2.html" id="p2">Second &amp; post</a></h2><span class="date">2020-01-02</span>
+			<h2 class="title"><a href="/post/3.html" id="p3">Third post</a></h2><span class="date">2020-01-03</span>
+		</div></body></html>`))
+	pat, matches, err := InduceIndexPattern(indexHtml, []string{"First post", "Second & post"})
+	if nil != err {
+		t.Fatalf("failed to induce index pattern: %s", err)
+	}
+	if `<a href="{link}" id="{text}">{title}</a>` != pat || 3 != matches {
+		t.Fatalf("wrong index pattern %s with %d matches", pat, matches)
+	}
+	if _, _, err = InduceIndexPattern(indexHtml, []string{"First post", "Fourth post"}); nil == err {
+		t.Fatal("title not in the page should fail")
+	}
+
+	contentHtml := MinifyHtml([]byte(`<html><body>
+		<div class="header"><div class="nav">Home</div></div>
+		<div class="entry-content">
+			<p>The first paragraph.</p>
+			<div class="quote"><p>Quoted text.</p></div>
+			<p>The second <em>paragraph</em>.</p>
+		</div>
+		<div class="comments">Comments</div>
+		</body></html>`))
+	pat, err = InduceContentPattern(contentHtml, "The first paragraph")
+	if nil != err {
+		t.Fatalf("failed to induce content pattern: %s", err)
+	}
+	if `<div class="entry-content">{description}</div><div class="comments">` != pat {
+		t.Fatalf("wrong content pattern %s", pat)
+	}
+	reg, err := CompilePattern(pat, nil)
+	if nil != err || !strings.HasSuffix(string(reg.FindSubmatch(contentHtml)[1]), "<em>paragraph</em>.</p>") {
+		t.Fatalf("content pattern %s should match the whole article", pat)
+	}
+}
+
+func TestUIHandler(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><body><ul><li><a href="/post/1">Post 1</a></li><li><a href="/post/2">Post 2</a></li></ul></body></html>`)
+		default:
+			fmt.Fprint(w, `<html><body><div id="content">`+r.URL.Path+`</div></body></html>`)
+		}
+	}))
+	defer site.Close()
+
+	cacheDB := filepath.Join(os.TempDir(), "gofeed_ui_test.db")
+	os.Remove(cacheDB)
+	if err := CreateDBScheme(cacheDB); nil != err {
+		t.Fatalf("failed to create cache db: %s", err)
+	}
+	defer os.Remove(cacheDB)
+	ui := httptest.NewServer(NewUIHandler(&Config{CacheDB: cacheDB}, UI_DEFAULT_ADDR))
+	defer ui.Close()
+
+	post := func(path string, req UIRequest, resp interface{}) {
+		body, _ := json.Marshal(req)
+		httpResp, err := http.Post(ui.URL+path, "application/json", bytes.NewReader(body))
+		if nil != err {
+			t.Fatalf("failed to post %s: %s", path, err)
+		}
+		defer httpResp.Body.Close()
+		if err = json.NewDecoder(httpResp.Body).Decode(resp); nil != err {
+			t.Fatalf("failed to decode response of %s: %s", path, err)
+		}
+	}
+
+	var fetchResp UIFetchResponse
+	post("/fetch", UIRequest{URL: site.URL + "/"}, &fetchResp)
+	if "" != fetchResp.Error || !strings.HasPrefix(fetchResp.Html, "<html><body><ul>") {
+		t.Fatalf("wrong fetch response %v", fetchResp)
+	}
+
+	var previewResp UIPreviewResponse
+	post("/preview", UIRequest{
+		URL:            site.URL + "/",
+		Path:           "feed.xml",
+		IndexPattern:   `<li><a href="{link}">{title}</a></li>`,
+		ContentPattern: `<div id="content">{description}</div>`,
+	}, &previewResp)
+	if "" != previewResp.Error || 2 != len(previewResp.Entries) || "/post/2" != previewResp.Entries[1].Description {
+		t.Fatalf("wrong preview response %v", previewResp)
+	}
+	var tar TargetConfig
+	if err := json.Unmarshal([]byte(previewResp.Config), &tar); nil != err || "feed.xml" != tar.FeedPath ||
+		1 != len(tar.IndexPatterns) || `<li><a href="{link}">{title}</a></li>` != tar.IndexPatterns[0] {
+		t.Fatalf("wrong exported config %s", previewResp.Config)
+	}
+
+	post("/preview", UIRequest{URL: site.URL + "/", IndexPattern: `<li>{title}</li>`}, &previewResp)
+	if "" == previewResp.Error || 0 == len(previewResp.Issues) {
+		t.Fatalf("invalid pattern should fail, got %v", previewResp)
+	}
+
+	// index pattern is previewed before the content pattern is written
+	previewResp = UIPreviewResponse{}
+	post("/preview", UIRequest{URL: site.URL + "/", IndexPattern: `<li><a href="{link}">{title}</a></li>`}, &previewResp)
+	if "" != previewResp.Error || 2 != len(previewResp.Entries) || 1 != len(previewResp.Issues) ||
+		!strings.Contains(previewResp.Issues[0], "Feed.ContentPattern") {
+		t.Fatalf("wrong preview response without content pattern %v", previewResp)
+	}
+
+	// requests of other sites are rejected
+	for _, header := range []map[string]string{
+		map[string]string{"Content-Type": "text/plain"},
+		map[string]string{"Content-Type": "application/json", "Host": "attacker.example"},
+		map[string]string{"Content-Type": "application/json", "Origin": "http://attacker.example"},
+	} {
+		httpReq, _ := http.NewRequest(http.MethodPost, ui.URL+"/fetch", strings.NewReader(`{"URL": "`+site.URL+`/"}`))
+		for key, value := range header {
+			httpReq.Header.Set(key, value)
+		}
+		httpReq.Host = httpReq.Header.Get("Host")
+		httpResp, err := http.DefaultClient.Do(httpReq)
+		if nil != err {
+			t.Fatalf("failed to post /fetch: %s", err)
+		}
+		httpResp.Body.Close()
+		if http.StatusOK == httpResp.StatusCode {
+			t.Fatalf("request with %v should be rejected", header)
+		}
+	}
+
+	// no trace reports are written for the previews out of debug mode
+	*gDebug = false
+	defer func() { *gDebug = true }()
+	previewResp = UIPreviewResponse{}
+	post("/preview", UIRequest{URL: site.URL + "/", IndexPattern: `<h3><a href="{link}">{title}</a></h3>`}, &previewResp)
+	if 1 != len(previewResp.Steps) || !previewResp.Steps[0].Failed || "" != previewResp.Steps[0].Trace {
+		t.Fatalf("failed step should have no trace report, got %v", previewResp.Steps)
+	}
+}
+
+func TestInitTargetConfig(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><title>My &amp; Blog</title></head><body>
+				<ul class="nav"><li><a href="/">Home</a></li><li><a href="/about">About</a></li><li><a href="/tags">Tags</a></li></ul>
+				<h2 class="title"><a href="/post/1">The first post of the blog</a></h2>
+				<h2 class="title"><a href="/post/2">The second post of the blog</a></h2>
+				<h2 class="title"><a href="/post/3">The third post of the blog</a></h2>
+				</body></html>`)
+		case "/feed":
+			fmt.Fprint(w, `<html><head><title>Feed blog</title>
+				<link rel="stylesheet" type="text/css" href="/style.css">
+				<link rel="alternate" type="application/rss+xml" href="/rss.xml">
+				<link rel="alternate" type="application/atom+xml" href="/atom.xml">
+				</head><body></body></html>`)
+		case "/empty":
+			fmt.Fprint(w, `<html><body>
+				<h2 class="title"><a href="/empty/1">The first empty post</a></h2>
+				<h2 class="title"><a href="/empty/2">The second empty post</a></h2>
+				<h2 class="title"><a href="/empty/3">The third empty post</a></h2>
+				</body></html>`)
+		case "/empty/1":
+			fmt.Fprint(w, `<html><body></body></html>`)
+		case "/rss.xml":
+			fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Feed blog</title>
+				<item><title>Post 1</title><link>`+"http://"+r.Host+`/post/1</link></item></channel></rss>`)
+		default:
+			fmt.Fprint(w, `<html><body><div class="header">Header</div><div class="post-body"><p>A short one.</p>
+				<p>The longest paragraph of the article.</p></div><div class="footer">Footer</div></body></html>`)
+		}
+	}))
+	defer site.Close()
+
+	conf := &Config{CacheDB: filepath.Join(os.TempDir(), "gofeed_init_test.db")}
+	os.Remove(conf.CacheDB)
+	if err := CreateDBScheme(conf.CacheDB); nil != err {
+		t.Fatalf("failed to create cache db: %s", err)
+	}
+	defer os.Remove(conf.CacheDB)
+
+	pageURL, _ := url.Parse(site.URL + "/")
+	tar, err := InitTargetConfig(conf, pageURL, "blog.xml")
+	if nil != err {
+		t.Fatalf("failed to init target: %s", err)
+	}
+	if "My & Blog" != tar.Title || "blog.xml" != tar.FeedPath || "" != tar.Mode ||
+		1 != len(tar.IndexPatterns) || `<h2 class="title"><a href="{link}">{title}</a>` != tar.IndexPatterns[0] ||
+		1 != len(tar.ContentPatterns) || `<div class="post-body">{description}</div>` != tar.ContentPatterns[0] || "" != tar.ContentFallback {
+		t.Fatalf("wrong target %s", ExportTargetConfig(tar))
+	}
+
+	// content pages are extracted by readability if the content pattern cannot be induced
+	emptyPageURL, _ := url.Parse(site.URL + "/empty")
+	if tar, err = InitTargetConfig(conf, emptyPageURL, "empty.xml"); nil != err {
+		t.Fatalf("failed to init target: %s", err)
+	}
+	if 0 != len(tar.ContentPatterns) || EXTRACTOR_READABILITY != tar.ContentFallback || 0 != len(LintContentRules(tar)) ||
+		!strings.Contains(ExportTargetConfig(tar), `"Feed.ContentFallback": "readability"`) {
+		t.Fatalf("wrong target %s", ExportTargetConfig(tar))
+	}
+
+	feedPageURL, _ := url.Parse(site.URL + "/feed")
+	feeds := FindAlternateFeeds([]byte(`<link rel="alternate" type="application/rss+xml" href="/rss.xml"><link rel="alternate" type="text/html" href="/en">`), feedPageURL)
+	if 1 != len(feeds) || site.URL+"/rss.xml" != feeds[0].String() {
+		t.Fatalf("wrong feeds %v", feeds)
+	}
+	tar, err = InitTargetConfig(conf, feedPageURL, "blog.xml")
+	if nil != err {
+		t.Fatalf("failed to init target: %s", err)
+	}
+	if EXTRACTOR_FEED != tar.Mode || 1 != len(tar.URLs) || site.URL+"/rss.xml" != tar.URLs[0] ||
+		1 != len(tar.ContentPatterns) || `<div class="post-body">{description}</div>` != tar.ContentPatterns[0] {
+		t.Fatalf("wrong target %s", ExportTargetConfig(tar))
+	}
+}
+
+func TestReadabilityExtractor(t *testing.T) {
+	htmlData := MinifyHtml([]byte(`<html><head><title>post</title></head><body>
+		<div id="nav"><a href="/">Home</a><a href="/about">About</a></div>
+		<div class="main-wrapper">
+			<div class="post-content">
+				<p>The first paragraph of the article, which is long enough to be scored.</p>
+				<p>The second paragraph of the article, with a <a href="/link">link</a> in it.</p>
+				<p>The third paragraph, which is short.</p>
+			</div>
+			<div class="sidebar"><p>Sidebar text which is long enough, but it is junk, really.</p></div>
+			<div class="links"><p><a href="/1">A list of links which is long enough to be scored</a></p></div>
+		</div>
+		<div id="comments"><p>A comment which is long enough to be scored, and has commas, many, many.</p></div>
+		</body></html>`))
+
+	ext, _ := NewReadabilityExtractor(nil, nil)
+	fields, err := ext.ExtractContent(nil, nil, htmlData)
+	if nil != err {
+		t.Fatalf("failed to extract content: %s", err)
+	}
+	content := string(fields[PATTERN_CONTENT])
+	if !strings.HasPrefix(content, "<p>The first paragraph") || !strings.HasSuffix(content, "which is short.</p>") {
+		t.Fatalf("wrong content %s", content)
+	}
+
+	// paragraphs of the negative nodes or full of links are not readable
+	for _, page := range []string{
+		`<html><body><div class="promo"><p>A promotion which is long enough to be scored, but it is junk.</p></div></body></html>`,
+		`<html><body><div><p><a href="/1">A list of links which is long enough to be scored</a></p></div></body></html>`,
+	} {
+		if _, err := ext.ExtractContent(nil, nil, []byte(page)); nil == err {
+			t.Fatalf("no readable content should be found in %s", page)
+		}
+	}
+
+	// readability is used when the content pattern fails
+	tar := &TargetConfig{
+		URLs:            []string{"http://blog.example.com/"},
+		IndexPatterns:   []string{`<a href="{link}">{title}</a>`},
+		ContentPatterns: []string{`<div class="entry">{description}</div>`},
+		ContentFallback: EXTRACTOR_READABILITY,
+	}
+	feedTar, err := BuildFeedTarget(&Config{CacheDB: filepath.Join(os.TempDir(), "gofeed_readability_test.db")}, tar)
+	if nil != err {
+		t.Fatalf("failed to build feed target: %s", err)
+	}
+	link, _ := url.Parse("http://blog.example.com/post/1")
+	feed := &Feed{URL: feedTar.URLs[0]}
+	fields, err = ExtractContentWithFallback(feedTar, feed, &FeedEntry{Link: link, IndexPattern: feedTar.IndexRegs[0]}, htmlData)
+	if nil != err || content != string(fields[PATTERN_CONTENT]) {
+		t.Fatalf("readability should be used as fallback, got %s, %v", fields[PATTERN_CONTENT], err)
+	}
+
+	// and when the content pattern is omitted
+	tar.ContentPatterns = nil
+	if issues := LintContentRules(tar); 0 != len(issues) {
+		t.Fatalf("content pattern should be optional with Feed.ContentFallback, got %v", issues)
+	}
+	if feedTar, err = BuildFeedTarget(&Config{CacheDB: filepath.Join(os.TempDir(), "gofeed_readability_test.db")}, tar); nil != err {
+		t.Fatalf("failed to build feed target: %s", err)
+	}
+	fields, err = ExtractContentWithFallback(feedTar, feed, &FeedEntry{Link: link, IndexPattern: feedTar.IndexRegs[0]}, htmlData)
+	if nil != err || content != string(fields[PATTERN_CONTENT]) {
+		t.Fatalf("readability should be used without content pattern, got %s, %v", fields[PATTERN_CONTENT], err)
+	}
+
+	tar.ContentFallback = "unknown"
+	if _, err = BuildFeedTarget(&Config{}, tar); nil == err {
+		t.Fatal("unknown Feed.ContentFallback should fail")
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	htmlData := []byte(`<html><head>
+		<meta property="og:title" content="Title of og">
+		<meta property="article:author" content="https://example.com/author/bob">
+		<meta name="author" content="Bob">
+		<meta property="og:image" content="/images/cover.png">
+		<script type="application/ld+json">{"@context": "https://schema.org", "@graph": [
+			{"@type": "WebPage", "name": "Page"},
+			{"@type": "BlogPosting", "headline": "Title &amp; json-ld", "datePublished": "2020-05-01T08:00:00+08:00",
+				"author": [{"@type": "Person", "name": "Alice"}]}
+		]}</script>
+		</head><body></body></html>`)
+
+	meta := ExtractMetadata(htmlData)
+	for field, value := range map[string]string{
+		PATTERN_TITLE:   "Title &amp; json-ld",
+		PATTERN_PUBDATE: "2020-05-01T08:00:00+08:00",
+		PATTERN_AUTHOR:  "Alice",
+		PATTERN_IMAGE:   "/images/cover.png",
+	} {
+		if value != string(meta[field]) {
+			t.Errorf("%s should be %s, got %s", field, value, meta[field])
+		}
+	}
+	if meta = ExtractMetaTagMetadata(htmlData); "Bob" != string(meta[PATTERN_AUTHOR]) {
+		t.Errorf("author url should be skipped, got %s", meta[PATTERN_AUTHOR])
+	}
+
+	// fields which are not empty are kept
+	link, _ := url.Parse("http://blog.example.com/post/1")
+	entry := &FeedEntry{Link: link, Title: "Title of index"}
+	filled := ApplyMetadata(entry, htmlData)
+	if "author,pubdate,image" != strings.Join(filled, ",") {
+		t.Errorf("wrong filled fields %v", filled)
+	}
+	if "Title of index" != entry.Title || "Alice" != entry.Author || nil == entry.PubDate ||
+		1588291200 != entry.PubDate.Unix() || "http://blog.example.com/images/cover.png" != entry.Image.String() {
+		t.Errorf("wrong entry %+v", entry)
+	}
+}
+
+func TestHFeedExtractor(t *testing.T) {
+	indexData := MinifyHtml([]byte(`<html><body><div class="h-feed">
+		<article class="h-entry">
+			<h2 class="p-name"><a class="u-url" href="/2020/hello">Hello world</a></h2>
+			<time class="dt-published" datetime="2020-05-01T08:00:00+08:00">May 1</time>
+			<a class="p-author h-card" href="/"><span class="p-name">Alice</span></a>
+			<a class="p-category" href="/tags/go">go</a> <a class="p-category" href="/tags/web">web</a>
+			<p class="p-summary">The summary.</p>
+			<div class="h-cite"><a class="u-url" href="/reply">a reply</a></div>
+		</article>
+		<div class="h-entry"><a href="/notes/1">A note</a></div>
+		<div class="h-entry"><p class="p-name">no link</p><a href="/1">1</a><a href="/2">2</a></div>
+		</div></body></html>`))
+	contentData := MinifyHtml([]byte(`<html><body>
+		<div class="h-entry"><a class="u-url" href="/other">Other</a><div class="e-content">other</div></div>
+		<article class="h-entry"><a class="u-url" href="/2020/hello">Hello</a>
+			<img class="u-photo" src="/cover.png" alt="cover">
+			<div class="e-content"><p>Full <b>text</b></p></div></article>
+		</body></html>`))
+
+	tar := &TargetConfig{URLs: []string{"http://blog.example.com/"}, Mode: EXTRACTOR_HFEED}
+	feedTar, err := BuildFeedTarget(&Config{CacheDB: filepath.Join(os.TempDir(), "gofeed_hfeed_test.db")}, tar)
+	if nil != err || EXTRACTOR_HFEED != feedTar.ContentMode {
+		t.Fatalf("content mode should default to %s: %v", EXTRACTOR_HFEED, err)
+	}
+	feed := &Feed{URL: feedTar.URLs[0]}
+	entries, err := feedTar.IndexExtractor.ExtractIndex(feed, feedTar.URLs[0], indexData)
+	if nil != err || 2 != len(entries) {
+		t.Fatalf("should extract 2 entries, got %d: %v", len(entries), err)
+	}
+	entry := entries[0]
+	if "Hello world" != entry.Title || "http://blog.example.com/2020/hello" != entry.Link.String() || "Alice" != entry.Author ||
+		nil == entry.PubDate || 1588291200 != entry.PubDate.Unix() || "go,web" != strings.Join(entry.Categories, ",") ||
+		"The summary." != string(entry.Content) {
+		t.Fatalf("wrong entry %+v", entry)
+	}
+	if "http://blog.example.com/notes/1" != entries[1].Link.String() {
+		t.Fatalf("wrong implied url %s", entries[1].Link)
+	}
+
+	// the h-entry of the permalink is used
+	fields, err := feedTar.ContentExtractor.ExtractContent(feed, entry, contentData)
+	if nil != err || "<p>Full<b>text</b></p>" != string(fields[PATTERN_CONTENT]) || "/cover.png" != string(fields[PATTERN_IMAGE]) {
+		t.Fatalf("wrong content fields %q: %v", fields, err)
+	}
+	if _, ok := fields[PATTERN_TITLE]; ok {
+		t.Fatal("title of the index page should be kept")
+	}
+}
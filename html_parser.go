@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"golang.org/x/net/html"
 	"log"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
@@ -16,6 +19,61 @@ func ExtractHtmlTitle(htmlData []byte) string {
 	return string(matches[1])
 }
 
+func ParseHtmlDom(htmlData []byte) (*html.Node, error) {
+	return html.Parse(bytes.NewReader(htmlData))
+}
+
+// set title, link, description, pubdate or other fields of feed entry with the extracted value,
+// relative link and image are resolved against baseURL
+func SetEntryField(feedTar *FeedTarget, feed *Feed, entry *FeedEntry, baseURL *url.URL, fieldName string, value []byte) {
+	switch fieldName {
+	case PATTERN_TITLE:
+		entry.Title = string(value)
+	case PATTERN_LINK:
+		// normalize entry link which may be relative
+		link, err := baseURL.Parse(string(value))
+		if nil != err {
+			log.Printf("[ERROR] error parsing entry link %s: %s", value, err)
+		} else {
+			entry.Link = link
+		}
+	case PATTERN_CONTENT:
+		entry.Content = value
+	case PATTERN_AUTHOR:
+		entry.Author = strings.TrimSpace(html.UnescapeString(string(value)))
+	case PATTERN_CATEGORY:
+		// comma separated categories, such as "golang, rss"
+		for _, category := range strings.Split(html.UnescapeString(string(value)), ",") {
+			if category = strings.TrimSpace(category); "" != category && !StringInSlice(category, entry.Categories) {
+				entry.Categories = append(entry.Categories, category)
+			}
+		}
+	case PATTERN_IMAGE:
+		image, err := baseURL.Parse(html.UnescapeString(strings.TrimSpace(string(value))))
+		if nil != err {
+			log.Printf("[ERROR] error parsing entry image %s: %s", value, err)
+		} else {
+			entry.Image = image
+		}
+	case PATTERN_SUMMARY:
+		entry.Summary = strings.TrimSpace(string(value))
+	case PATTERN_PUBDATE:
+		var pubDate time.Time
+		var err error
+		if pubDateReg := FindPubDateReg(feedTar, feed.URL); nil != pubDateReg {
+			pubDate, err = ParsePubDate(pubDateReg, string(value))
+		} else {
+			// no pubdate pattern, try standard time formats
+			pubDate, err = ParseStandardTime(string(value))
+		}
+		if nil != err {
+			log.Printf("[ERROR] error parsing pubdate of link %s: %s", entry.Link, err)
+		} else {
+			entry.PubDate = &pubDate
+		}
+	}
+}
+
 func FilterHtmlWithoutPattern(htmlData []byte, pattern string) bool {
 	html := string(htmlData)
 	for _, str := range PATTERN_ALL_REGEX.Split(pattern, -1) {
@@ -24,11 +82,7 @@ func FilterHtmlWithoutPattern(htmlData []byte, pattern string) bool {
 		}
 		if !strings.Contains(html, str) {
 			log.Printf("[ERROR] target html does not contain %s", str)
-			if *gDebug {
-				log.Println("======= debug: target html data =======")
-				log.Println(string(htmlData))
-				log.Println("==============")
-			}
+			TraceFailedRegex("", regexp.MustCompile(regexp.QuoteMeta(str)), nil, htmlData, nil)
 
 			return false
 		}
@@ -37,127 +91,155 @@ func FilterHtmlWithoutPattern(htmlData []byte, pattern string) bool {
 	return true
 }
 
-func ParseIndexHtml(feedTar *FeedTarget) (feed *Feed, ok bool) {
-	feed = new(Feed)
+// find next page with Feed.NextPagePattern or Feed.ContentNextPagePattern, return nil if not found
+func FindNextPageURL(nextPageReg *regexp.Regexp, pageURL *url.URL, htmlData []byte) *url.URL {
+	if nil == nextPageReg {
+		return nil
+	}
 
-	for urlInd, tarURL := range feedTar.URLs {
-		// get cache
-		indexCache, err := FetchHtml(tarURL, feedTar)
-		if nil == indexCache || nil != err {
-			log.Printf("[ERROR] failed to download index web page %s", tarURL.String())
-			// just ignore the sucker, feed.URL = nil
+	match := nextPageReg.FindSubmatch(htmlData)
+	if nil == match {
+		if *gVerbose {
+			log.Printf("next page pattern did not match %s, stop paging", pageURL.String())
+		}
+		return nil
+	}
+	for patInd, patName := range nextPageReg.SubexpNames() {
+		if PATTERN_LINK != patName {
 			continue
 		}
+		nextURL, err := pageURL.Parse(html.UnescapeString(strings.TrimSpace(string(match[patInd]))))
+		if nil != err {
+			log.Printf("[ERROR] error parsing next page link %s: %s", match[patInd], err)
+			return nil
+		}
+		return nextURL
+	}
 
-		// minify html
-		htmlData := MinifyHtml(RemoveJunkContent(indexCache.Html))
+	return nil
+}
 
-		// extract feed entry title and link
-		indRegs := FindIndexRegs(feedTar, tarURL)
-		for ind, indexReg := range indRegs {
-			if nil == indexReg {
-				log.Printf("[ERROR] cannot find index regex for %s", tarURL.String())
-				continue
-			}
+func ParseIndexHtml(feedTar *FeedTarget) (feed *Feed, ok bool) {
+	feed = new(Feed)
+	// index pages already crawled, used to avoid paging loops
+	visitedPages := make(map[string]bool)
+	maxPages := feedTar.MaxPages
+	if 0 >= maxPages {
+		maxPages = 1
+	}
+	if nil == feedTar.IndexPageOrigins {
+		feedTar.IndexPageOrigins = make(map[*url.URL]*url.URL)
+	}
 
-			// make a copy of source data
-			var htmlDataCopy []byte
-			if ind+1 == len(indRegs) {
-				htmlDataCopy = htmlData
-			} else {
-				htmlDataCopy = make([]byte, len(htmlData))
-				copy(htmlDataCopy, htmlData)
+	for _, tarURL := range feedTar.URLs {
+		pageURL := tarURL
+		for pageNum := 1; nil != pageURL && pageNum <= maxPages; pageNum++ {
+			if visitedPages[pageURL.String()] {
+				log.Printf("[WARN] index page %s has been crawled, stop paging", pageURL.String())
+				break
 			}
-
-			// filter html with index filter
-			indexFilterReg := FindIndexFilterReg(feedTar, indexReg)
-			if nil != indexFilterReg {
-				htmlDataCopy = RegexpFilter(indexFilterReg, htmlDataCopy)
-				if nil == htmlDataCopy {
-					// failed to filter htmlData
-					continue
+			visitedPages[pageURL.String()] = true
+			if 1 < pageNum {
+				feedTar.IndexPageOrigins[pageURL] = tarURL
+				if *gVerbose {
+					log.Printf("waiting for %d seconds before sending request to %s", feedTar.ReqInterval, pageURL.String())
 				}
+				time.Sleep(feedTar.ReqInterval * time.Second)
 			}
 
-			matches := indexReg.FindAllSubmatch(htmlDataCopy, -1)
-			if nil == matches {
-				log.Printf("[ERROR] failed to match index html %s, pattern %s did not match", tarURL.String(), indexReg.String())
-				if *gDebug {
-					log.Println("======= debug: target html data =======")
-					log.Println(string(htmlDataCopy))
-					log.Println("==============")
-				}
-				// ignore this
-				continue
+			// get cache
+			indexCache, err := FetchHtml(pageURL, feedTar)
+			if nil == indexCache || nil != err {
+				log.Printf("[ERROR] failed to download index web page %s", pageURL.String())
+				// just ignore the sucker
+				break
 			}
 
-			entries := make([]*FeedEntry, len(matches))
-			for matchInd, match := range matches {
-				entries[matchInd] = new(FeedEntry)
-				entry := entries[matchInd] // pointer of FeedEntry
-				entry.IndexPattern = indexReg
-				for patInd, patName := range indexReg.SubexpNames() {
-					switch patName {
-					case PATTERN_TITLE:
-						entry.Title = string(match[patInd])
-					case PATTERN_LINK:
-						// normalize entry link which may be relative
-						entry.Link, err = tarURL.Parse(string(match[patInd]))
-						if nil != err {
-							log.Printf("[ERROR] error parsing entry link %s: %s", entry.Link, err)
-						}
-					case PATTERN_PUBDATE:
-						var pubDate time.Time
-						pubDate, err = ParsePubDate(FindPubDateReg(feedTar, feed.URL), string(match[patInd]))
-						if nil != err {
-							log.Printf("[ERROR] error parsing pubdate of link %s: %s", entry.Link, err)
-						} else {
-							entry.PubDate = &pubDate
-						}
-					}
-				}
+			// index page may be gzip compressed, such as sitemap.xml.gz
+			htmlData, err := GunzipData(indexCache.Html)
+			if nil != err {
+				log.Printf("[ERROR] failed to decompress index web page %s: %s", pageURL.String(), err)
+				break
 			}
 
-			// add entries to feed
+			// minify html, feeds and json apis are extracted as they are
+			rawData := htmlData
+			htmlData = MinifyHtml(RemoveJunkContent(htmlData))
+
+			// extract feed entry title and link
+			entries, err := feedTar.IndexExtractor.ExtractIndex(feed, pageURL, IndexExtractorData(feedTar, rawData, htmlData))
+			if nil != err {
+				log.Printf("[ERROR] failed to extract entries from index html %s with %s extractor: %s", pageURL.String(), feedTar.IndexMode, err)
+			}
 			feed.Entries = append(feed.Entries, entries...)
-		}
 
-		if 0 == urlInd {
-			feed.Title = feedTar.Title
-			feed.Description = feedTar.Description
-			// use first index page and url
-			feed.URL = tarURL
-			dateNow := time.Now()
-			if nil == indexCache.LastModified {
-				feed.LastModified = &dateNow
+			if nil == feed.URL {
+				feed.Title = feedTar.Title
+				feed.Description = feedTar.Description
+				// use first index page and url
+				feed.URL = tarURL
+				dateNow := time.Now()
+				if nil == indexCache.LastModified {
+					feed.LastModified = &dateNow
+				} else {
+					feed.LastModified = indexCache.LastModified
+				}
 			} else {
-				feed.LastModified = indexCache.LastModified
-			}
-		} else {
-			// use later lastmod time
-			if nil != indexCache.LastModified && feed.LastModified.Before(*indexCache.LastModified) {
-				feed.LastModified = indexCache.LastModified
+				// use later lastmod time
+				if nil != indexCache.LastModified && feed.LastModified.Before(*indexCache.LastModified) {
+					feed.LastModified = indexCache.LastModified
+				}
 			}
+
+			pageURL = FindNextPageURL(feedTar.NextPageReg, pageURL, htmlData)
 		}
 	}
 	return feed, true
 }
 
+// follow Feed.ContentNextPagePattern of a multi-page article and append description
+// of each page to entry content, htmlData is the first page of the article
+func ParseContentNextPages(feedTar *FeedTarget, feed *Feed, entry *FeedEntry, htmlData []byte) {
+	visitedPages := map[string]bool{entry.Link.String(): true}
+	pageURL := FindNextPageURL(feedTar.ContentNextPageReg, entry.Link, htmlData)
+	for pageNum := 2; nil != pageURL && pageNum <= feedTar.ContentMaxPages; pageNum++ {
+		if visitedPages[pageURL.String()] {
+			log.Printf("[WARN] content page %s has been crawled, stop paging", pageURL.String())
+			return
+		}
+		visitedPages[pageURL.String()] = true
+
+		if *gVerbose {
+			log.Printf("waiting for %d seconds before sending request to %s", feedTar.ReqInterval, pageURL.String())
+		}
+		time.Sleep(feedTar.ReqInterval * time.Second)
+
+		cache, err := FetchHtml(pageURL, feedTar)
+		if nil == cache || nil != err {
+			log.Printf("[ERROR] failed to download content page %s of %s", pageURL.String(), entry.Link.String())
+			return
+		}
+		htmlData = MinifyHtml(RemoveJunkContent(cache.Html))
+
+		fields, err := ExtractContentWithFallback(feedTar, feed, entry, htmlData)
+		if nil != err {
+			log.Printf("[ERROR] failed to extract content page %s with %s extractor: %s", pageURL.String(), feedTar.ContentMode, err)
+			return
+		}
+		entry.Content = append(entry.Content, fields[PATTERN_CONTENT]...)
+
+		pageURL = FindNextPageURL(feedTar.ContentNextPageReg, pageURL, htmlData)
+	}
+}
+
 func ParseContentHtml(feedTar *FeedTarget, feed *Feed) (ok bool) {
-	validEntries := make([]*FeedEntry, 1)
-	validEntryInd := 0
+	validEntries := make([]*FeedEntry, 0, len(feed.Entries))
 	for entryInd, entry := range feed.Entries {
 		if nil == entry {
 			log.Printf("[ERROR] failed to parse content html: entry is nil")
 			continue
 		}
 
-		contentReg := FindContentReg(feedTar, feed.URL, entry.IndexPattern)
-		if nil == contentReg {
-			log.Printf("[ERROR] failed to find content regex for entry %s", entry.Link.String())
-			return
-		}
-
 		// check entry link
 		if nil == entry.Link {
 			log.Printf("[ERROR] entry link is nil, ignore this. entry index is %d", entryInd)
@@ -176,50 +258,39 @@ func ParseContentHtml(feedTar *FeedTarget, feed *Feed) (ok bool) {
 			// ignore this entry, entry.Cache = nil
 			continue
 		} else {
-			validEntries = append(validEntries[:validEntryInd], entry)
-			validEntryInd += 1
+			validEntries = append(validEntries, entry)
 		}
 		entry.Cache = cache
 
 		htmlData := MinifyHtml(RemoveJunkContent(cache.Html))
 
-		// filter html with content filter
-		contFilterReg := FindContentFilterReg(feedTar, contentReg)
-		if nil != contFilterReg {
-			htmlData := RegexpFilter(contFilterReg, htmlData)
-			if nil == htmlData {
-				// failed to filter htmlData
-				continue
+		// fields extracted from the content page override the metadata. json-ld blocks are
+		// scripts, which have been removed from htmlData
+		if feedTar.Metadata {
+			if filled := ApplyMetadata(entry, cache.Html); *gVerbose && 0 != len(filled) {
+				log.Printf("%s of %s are filled with metadata", strings.Join(filled, ", "), entry.Link.String())
 			}
 		}
 
-		// extract feed entry content(description)
-		match := contentReg.FindSubmatch(htmlData)
-		if nil == match {
-			log.Printf("[ERROR] failed to match content html %s, pattern %s match failed", entry.Link.String(), contentReg.String())
-			if *gDebug {
-				log.Println("======= debug: target html data =======")
-				log.Println(string(htmlData))
-				log.Println("==============")
-			}
+		// index pages such as sitemaps may not provide entry title
+		if "" == entry.Title {
+			entry.Title = strings.TrimSpace(html.UnescapeString(ExtractHtmlTitle(htmlData)))
+		}
+
+		// extract feed entry content(description) and other fields
+		fields, err := ExtractContentWithFallback(feedTar, feed, entry, htmlData)
+		if nil != err {
+			log.Printf("[ERROR] failed to extract content html %s with %s extractor: %s", entry.Link.String(), feedTar.ContentMode, err)
 			// ignore this sucker
 			continue
 		}
-		for patInd, patName := range contentReg.SubexpNames() {
-			switch patName {
-			case PATTERN_CONTENT:
-				entry.Content = match[patInd]
-			case PATTERN_PUBDATE:
-				var pubDate time.Time
-				pubDate, err = ParsePubDate(FindPubDateReg(feedTar, feed.URL), string(match[patInd]))
-				if nil != err {
-					log.Printf("[ERROR] error parsing pubdate of link %s: %s", entry.Link, err)
-				} else {
-					entry.PubDate = &pubDate
-				}
-			}
+		for fieldName, value := range fields {
+			SetEntryField(feedTar, feed, entry, entry.Link, fieldName, value)
 		}
 
+		// append description of the continuation pages
+		ParseContentNextPages(feedTar, feed, entry, htmlData)
+
 		if 0 == len(entry.Content) {
 			// just print a warning message if content is empty
 			log.Printf("[WARN] feed entry has no description: %s", entry.Link.String())
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+func (f *StringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *StringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// gofeed induce, infer Feed.IndexPattern from example titles and Feed.ContentPattern
+// from a sample sentence of an article
+func RunInduceCommand(args []string) (ok bool) {
+	var titles StringsFlag
+	cmd := flag.NewFlagSet(CMD_INDUCE, flag.ExitOnError)
+	pageURL := cmd.String("url", "", "url of the index page")
+	indexFile := cmd.String("file", "", "read the index page from a local html file instead of downloading it")
+	cmd.Var(&titles, "title", "title of an entry copied from the index page, repeat it for 2 or more entries")
+	contentURL := cmd.String("content-url", "", "url of an article page")
+	contentFile := cmd.String("content-file", "", "read the article page from a local html file instead of downloading it")
+	sample := cmd.String("sample", "", "a sentence copied from the article")
+	cacheDB := cmd.String("cache", DB_NAME, "path of the cache database")
+	cmd.Usage = func() {
+		fmt.Printf("Usage %s induce [-url url|-file html_file -title title -title title...] [-content-url url|-content-file html_file -sample sentence]\n\n", os.Args[0])
+		fmt.Printf("Flags:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	induceIndex := "" != *pageURL || "" != *indexFile
+	induceContent := "" != *contentURL || "" != *contentFile
+	if 0 != cmd.NArg() || (!induceIndex && !induceContent) ||
+		(induceIndex && 0 == len(titles)) || (induceContent && "" == *sample) {
+		cmd.Usage()
+		return false
+	}
+
+	// pages are downloaded only if the local files are not given
+	var feedTar *FeedTarget
+	if ("" != *pageURL && "" == *indexFile) || ("" != *contentURL && "" == *contentFile) {
+		conf := &Config{CacheDB: *cacheDB}
+		if err := CheckConfig(conf); nil != err {
+			log.Printf("[ERROR] %s", err)
+			return false
+		}
+		feedTar = NewFetchTarget(conf)
+		if err := InitCacheDB(feedTar.CacheDB, feedTar.CacheLifetime); nil != err {
+			log.Printf("[ERROR] failed to create cache database %s", feedTar.CacheDB)
+			return false
+		}
+	}
+	loadPage := func(rawURL, file string) []byte {
+		var normalURL *url.URL
+		if "" == file {
+			var err error
+			if normalURL, err = url.Parse(NormalizeURLStr(rawURL)); nil != err {
+				log.Printf("[ERROR] invalid url %s: %s", rawURL, err)
+				return nil
+			}
+		}
+		htmlData, err := LoadTestPage(feedTar, normalURL, file)
+		if nil != err {
+			log.Printf("[ERROR] failed to load page: %s", err)
+			return nil
+		}
+		return htmlData
+	}
+
+	ok = true
+	if induceIndex {
+		if htmlData := loadPage(*pageURL, *indexFile); nil == htmlData {
+			ok = false
+		} else if pat, matches, err := InduceIndexPattern(htmlData, titles); nil != err {
+			log.Printf("[ERROR] failed to induce Feed.IndexPattern: %s", err)
+			ok = false
+		} else {
+			fmt.Printf("Feed.IndexPattern matched %d entries including the %d examples:\n", matches, len(titles))
+			PrintInducedPattern(os.Stdout, "Feed.IndexPattern", pat)
+		}
+	}
+	if induceContent {
+		if htmlData := loadPage(*contentURL, *contentFile); nil == htmlData {
+			ok = false
+		} else if pat, err := InduceContentPattern(htmlData, *sample); nil != err {
+			log.Printf("[ERROR] failed to induce Feed.ContentPattern: %s", err)
+			ok = false
+		} else {
+			fmt.Printf("Feed.ContentPattern extracted the element containing the sample:\n")
+			PrintInducedPattern(os.Stdout, "Feed.ContentPattern", pat)
+		}
+	}
+	return
+}
+
+// print the pattern as a json config line, html characters are not escaped
+func PrintInducedPattern(w io.Writer, key, pat string) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode([]string{pat})
+	fmt.Fprintf(w, "    \"%s\": %s\n", key, strings.TrimSpace(buf.String()))
+}
+
+// infer index pattern from the titles of 2 or more entries. The tokens around the titles are
+// generalized where they differ, and the candidate with the fewest matches is chosen from the
+// ones which contain {link} and match all the titles.
+func InduceIndexPattern(htmlData []byte, titles []string) (pat string, matches int, err error) {
+	if 2 > len(titles) {
+		return "", 0, errors.New("at least 2 example titles are required")
+	}
+	tokens := HTML_TOKEN_REGEX.FindAllString(string(htmlData), -1)
+	positions := make([]int, len(titles))
+	examples := make([]string, len(titles))
+	for ind, title := range titles {
+		examples[ind] = strings.TrimSpace(title)
+		if positions[ind] = FindTextToken(tokens, examples[ind], true); -1 == positions[ind] {
+			return "", 0, fmt.Errorf("title %q not found in the page", examples[ind])
+		}
+	}
+
+	// generalized tokens before and after the titles, the nearest ones first
+	var before, after []string
+	var linkBefore, linkAfter []bool
+	for _, side := range []struct {
+		step  int
+		parts *[]string
+		links *[]bool
+	}{
+		{-1, &before, &linkBefore},
+		{1, &after, &linkAfter},
+	} {
+		for offset := side.step; len(*side.parts) < INDUCE_MAX_CONTEXT; offset += side.step {
+			part, link, ok := GeneralizeTokens(ContextTokens(tokens, positions, offset))
+			if !ok {
+				break
+			}
+			*side.parts = append(*side.parts, part)
+			*side.links = append(*side.links, link)
+		}
+	}
+
+	// {text} is not used as the boundary of a pattern
+	hasLink := false
+	for beforeNum := 1; beforeNum <= len(before); beforeNum++ {
+		hasLink = hasLink || linkBefore[beforeNum-1]
+		if PATTERN_TEXT_FIELD == before[beforeNum-1] {
+			continue
+		}
+		afterLink := false
+		for afterNum := 1; afterNum <= len(after); afterNum++ {
+			afterLink = afterLink || linkAfter[afterNum-1]
+			if (!hasLink && !afterLink) || PATTERN_TEXT_FIELD == after[afterNum-1] {
+				continue
+			}
+			var candidate bytes.Buffer
+			for ind := beforeNum - 1; ind >= 0; ind-- {
+				candidate.WriteString(before[ind])
+			}
+			candidate.WriteString("{" + PATTERN_TITLE + "}")
+			candidate.WriteString(strings.Join(after[:afterNum], ""))
+
+			num := CountIndexMatches(candidate.String(), htmlData, examples)
+			if 0 < num && (0 == matches || num < matches) {
+				pat, matches = candidate.String(), num
+			}
+		}
+	}
+
+	if "" == pat {
+		return "", 0, errors.New("no common markup with {link} found around the titles")
+	}
+	return
+}
+
+// number of matches of pat in htmlData, 0 if pat does not extract all the titles
+func CountIndexMatches(pat string, htmlData []byte, titles []string) int {
+	reg, err := CompilePattern(pat, nil)
+	if nil != err {
+		return 0
+	}
+	titleInd := reg.SubexpIndex(PATTERN_TITLE)
+	extracted := make(map[string]bool)
+	matches := reg.FindAllSubmatch(htmlData, -1)
+	for _, match := range matches {
+		extracted[strings.TrimSpace(html.UnescapeString(string(match[titleInd])))] = true
+	}
+	for _, title := range titles {
+		if !extracted[title] {
+			return 0
+		}
+	}
+	return len(matches)
+}
+
+// infer content pattern from a sentence of the article. The nearest article or main element,
+// or the nearest container with id or class, which encloses the sentence is used.
+func InduceContentPattern(htmlData []byte, sample string) (pat string, err error) {
+	sample = strings.TrimSpace(sample)
+	tokens := HTML_TOKEN_REGEX.FindAllString(string(htmlData), -1)
+	pos := FindTextToken(tokens, sample, false)
+	if -1 == pos {
+		return "", fmt.Errorf("sample %q not found in the page", sample)
+	}
+
+	// find the container in the ancestors of the sample
+	openInd, body, depth := -1, -1, 0
+	for ind := pos - 1; 0 <= ind && -1 == openInd; ind-- {
+		name, closing := HtmlTagName(tokens[ind])
+		switch {
+		case "" == name || IsVoidTag(tokens[ind]):
+		case closing:
+			depth += 1
+		case 0 < depth:
+			depth -= 1
+		case IsContentContainer(name, tokens[ind]):
+			openInd = ind
+		case "body" == name:
+			body = ind
+		}
+	}
+	if -1 == openInd {
+		if openInd = body; -1 == openInd {
+			return "", errors.New("no container of the sample found")
+		}
+	}
+
+	// find the closing tag of the container
+	openName, _ := HtmlTagName(tokens[openInd])
+	closeInd := -1
+	depth = 0
+	for ind := openInd; ind < len(tokens) && -1 == closeInd; ind++ {
+		if name, closing := HtmlTagName(tokens[ind]); name != openName {
+			continue
+		} else if !closing {
+			depth += 1
+		} else if depth -= 1; 0 == depth {
+			closeInd = ind
+		}
+	}
+	if -1 == closeInd {
+		return "", fmt.Errorf("%s is not closed", tokens[openInd])
+	}
+
+	// add the tags around the container until the first match is the whole container
+	contentStart, contentEnd := 0, 0
+	for ind, token := range tokens[:closeInd] {
+		if ind <= openInd {
+			contentStart += len(token)
+		}
+		contentEnd += len(token)
+	}
+	for beforeNum := 0; beforeNum <= INDUCE_MAX_CONTEXT && 0 <= openInd-beforeNum; beforeNum++ {
+		if name, _ := HtmlTagName(tokens[openInd-beforeNum]); "" == name {
+			break
+		}
+		for afterNum := 0; afterNum <= INDUCE_MAX_CONTEXT && closeInd+afterNum < len(tokens); afterNum++ {
+			if name, _ := HtmlTagName(tokens[closeInd+afterNum]); "" == name {
+				break
+			}
+			var candidate bytes.Buffer
+			for _, token := range tokens[openInd-beforeNum : openInd+1] {
+				candidate.WriteString(regexp.QuoteMeta(token))
+			}
+			candidate.WriteString("{" + PATTERN_CONTENT + "}")
+			for _, token := range tokens[closeInd : closeInd+afterNum+1] {
+				candidate.WriteString(regexp.QuoteMeta(token))
+			}
+
+			reg, err := CompilePattern(candidate.String(), nil)
+			if nil != err {
+				continue
+			}
+			contentInd := reg.SubexpIndex(PATTERN_CONTENT)
+			if loc := reg.FindSubmatchIndex(htmlData); nil != loc && contentStart == loc[2*contentInd] && contentEnd == loc[2*contentInd+1] {
+				return candidate.String(), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("failed to match the sample with the markup around %s", tokens[openInd])
+}
+
+// index of the first text token which equals to or contains text, -1 if not found
+func FindTextToken(tokens []string, text string, equal bool) int {
+	for ind, token := range tokens {
+		if strings.HasPrefix(token, "<") {
+			continue
+		}
+		tokenText := strings.TrimSpace(html.UnescapeString(token))
+		if (equal && text == tokenText) || (!equal && strings.Contains(tokenText, text)) {
+			return ind
+		}
+	}
+	return -1
+}
+
+// tokens at offset from positions, nil if any of them is out of range
+func ContextTokens(tokens []string, positions []int, offset int) (context []string) {
+	for _, pos := range positions {
+		if pos+offset < 0 || pos+offset >= len(tokens) {
+			return nil
+		}
+		context = append(context, tokens[pos+offset])
+	}
+	return
+}
+
+// pattern which matches all the tokens. Different text becomes {text}, and tags of the same name and
+// attributes are merged, the different href values become {link} and the other values become {text}.
+func GeneralizeTokens(tokens []string) (part string, link bool, ok bool) {
+	if 0 == len(tokens) {
+		return "", false, false
+	}
+	same, tags := true, true
+	for _, token := range tokens {
+		same = same && token == tokens[0]
+		tags = tags && strings.HasPrefix(token, "<")
+	}
+	switch {
+	case same:
+		return regexp.QuoteMeta(tokens[0]), false, true
+	case !tags:
+		for _, token := range tokens {
+			if strings.HasPrefix(token, "<") {
+				return "", false, false
+			}
+		}
+		return PATTERN_TEXT_FIELD, false, true
+	}
+
+	skeleton := HTML_ATTR_REGEX.ReplaceAllString(tokens[0], `$1=""`)
+	attrs := make([][][]string, len(tokens))
+	for ind, token := range tokens {
+		if skeleton != HTML_ATTR_REGEX.ReplaceAllString(token, `$1=""`) {
+			return "", false, false
+		}
+		attrs[ind] = HTML_ATTR_REGEX.FindAllStringSubmatch(token, -1)
+	}
+
+	var buf bytes.Buffer
+	last := 0
+	for attrInd, loc := range HTML_ATTR_REGEX.FindAllStringSubmatchIndex(tokens[0], -1) {
+		value := tokens[0][loc[4]:loc[5]]
+		same = true
+		for _, tokenAttrs := range attrs {
+			same = same && value == tokenAttrs[attrInd][2]
+		}
+		if same {
+			continue
+		}
+		buf.WriteString(regexp.QuoteMeta(tokens[0][last:loc[4]]))
+		if "href" == strings.ToLower(attrs[0][attrInd][1]) && !link {
+			buf.WriteString("{" + PATTERN_LINK + "}")
+			link = true
+		} else {
+			buf.WriteString(PATTERN_TEXT_FIELD)
+		}
+		last = loc[5]
+	}
+	buf.WriteString(regexp.QuoteMeta(tokens[0][last:]))
+	return buf.String(), link, true
+}
+
+// lower case name of tag token and whether it is a closing tag, name is empty if token is not a tag
+func HtmlTagName(token string) (name string, closing bool) {
+	match := HTML_TAG_NAME_REGEX.FindStringSubmatch(token)
+	if nil == match {
+		return "", false
+	}
+	return strings.ToLower(match[2]), "/" == match[1]
+}
+
+func IsVoidTag(token string) bool {
+	if strings.HasSuffix(token, "/>") {
+		return true
+	}
+	name, _ := HtmlTagName(token)
+	for _, void := range HTML_VOID_TAGS {
+		if void == name {
+			return true
+		}
+	}
+	return false
+}
+
+func IsContentContainer(name, token string) bool {
+	for _, container := range INDUCE_CONTENT_TAGS {
+		if container != name {
+			continue
+		}
+		if "article" == name || "main" == name {
+			return true
+		}
+		for _, attr := range HTML_ATTR_REGEX.FindAllStringSubmatch(token, -1) {
+			if attrName := strings.ToLower(attr[1]); ("id" == attrName || "class" == attrName) && "" != attr[2] {
+				return true
+			}
+		}
+	}
+	return false
+}
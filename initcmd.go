@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// gofeed init, print a starter target for the page
+func RunInitCommand(args []string) (ok bool) {
+	cmd := flag.NewFlagSet(CMD_INIT, flag.ExitOnError)
+	feedPath := cmd.String("path", "", "Feed.Path of the target, default is <host>.xml")
+	cacheDB := cmd.String("cache", DB_NAME, "path of the cache database where the fetched pages are cached")
+	cmd.Usage = func() {
+		fmt.Printf("Usage %s init [-path feed_path][-cache cache_db] url\n\n", os.Args[0])
+		fmt.Printf("Flags:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if 1 != cmd.NArg() {
+		cmd.Usage()
+		return false
+	}
+	pageURL, err := url.Parse(NormalizeURLStr(cmd.Arg(0)))
+	if nil != err || !pageURL.IsAbs() {
+		log.Printf("[ERROR] invalid url %s", cmd.Arg(0))
+		return false
+	}
+	if "" == *feedPath {
+		*feedPath = strings.Replace(pageURL.Host, ":", "_", -1) + ".xml"
+	}
+	conf := &Config{CacheDB: *cacheDB}
+	if err = CheckConfig(conf); nil != err {
+		log.Printf("[ERROR] %s", err)
+		return false
+	}
+	if err = InitCacheDB(conf.CacheDB, ExtractCacheLifetime(conf.CacheLifetime)); nil != err {
+		log.Printf("[ERROR] failed to create cache database %s", conf.CacheDB)
+		return false
+	}
+
+	tar, err := InitTargetConfig(conf, pageURL, *feedPath)
+	if nil != err {
+		log.Printf("[ERROR] failed to init target of %s: %s", pageURL.String(), err)
+		return false
+	}
+	fmt.Print(ExportTargetConfig(tar))
+	return true
+}
+
+// guess the target of pageURL. The first feed of <link rel="alternate"> is read in feed mode,
+// otherwise Feed.IndexPattern is induced from the repeated links of the page. Feed.ContentPattern
+// is induced from the page of the first entry if possible, otherwise content pages are extracted
+// by the readability fallback.
+func InitTargetConfig(conf *Config, pageURL *url.URL, feedPath string) (tar *TargetConfig, err error) {
+	fetchTar := NewFetchTarget(conf)
+	htmlData, err := LoadTestPage(fetchTar, pageURL, "")
+	if nil != err {
+		return
+	}
+	tar = &TargetConfig{Title: strings.TrimSpace(html.UnescapeString(ExtractHtmlTitle(htmlData))), FeedPath: feedPath}
+
+	if feeds := FindAlternateFeeds(htmlData, pageURL); 0 != len(feeds) {
+		for _, feedURL := range feeds[1:] {
+			log.Printf("other feed found: %s", feedURL.String())
+		}
+		log.Printf("feed %s found, which is read in %s mode", feeds[0].String(), EXTRACTOR_FEED)
+		tar.URLs = []string{feeds[0].String()}
+		tar.Mode = EXTRACTOR_FEED
+	} else {
+		tar.URLs = []string{pageURL.String()}
+		for _, titles := range GuessIndexTitles(htmlData) {
+			if len(titles) > INIT_MAX_EXAMPLES {
+				titles = titles[:INIT_MAX_EXAMPLES]
+			}
+			pat, matches, induceErr := InduceIndexPattern(htmlData, titles)
+			if nil == induceErr {
+				log.Printf("Feed.IndexPattern matched %d entries", matches)
+				tar.IndexPatterns = []string{pat}
+				break
+			}
+		}
+		if 0 == len(tar.IndexPatterns) {
+			return nil, errors.New("neither feeds nor repeated links are found")
+		}
+	}
+
+	// content pattern is optional, so the target is returned with the readability fallback if it fails
+	feedTar, err := BuildFeedTarget(conf, tar)
+	if nil != err {
+		return
+	}
+	tar.ContentFallback = EXTRACTOR_READABILITY
+	if EXTRACTOR_FEED == tar.Mode {
+		if htmlData, err = ReadTestPage(fetchTar, feedTar.URLs[0], ""); nil != err {
+			log.Printf("[WARN] failed to load feed %s: %s", tar.URLs[0], err)
+			return tar, nil
+		}
+	}
+	entries, err := feedTar.IndexExtractor.ExtractIndex(&Feed{URL: feedTar.URLs[0]}, feedTar.URLs[0], htmlData)
+	if nil != err || 0 == len(entries) || nil == entries[0].Link {
+		log.Printf("[WARN] no entry extracted from %s, Feed.ContentPattern is not induced", tar.URLs[0])
+		return tar, nil
+	}
+	contentData, err := LoadTestPage(fetchTar, entries[0].Link, "")
+	if nil != err {
+		log.Printf("[WARN] failed to load content page %s: %s", entries[0].Link.String(), err)
+		return tar, nil
+	}
+	pat, err := GuessContentPattern(contentData)
+	if nil != err {
+		log.Printf("[WARN] failed to induce Feed.ContentPattern from %s: %s", entries[0].Link.String(), err)
+		return tar, nil
+	}
+	tar.ContentPatterns = []string{pat}
+	tar.ContentFallback = ""
+	return tar, nil
+}
+
+// feeds of <link rel="alternate"> which can be read by the feed extractor, in the order of the page
+func FindAlternateFeeds(htmlData []byte, pageURL *url.URL) (feeds []*url.URL) {
+	for _, tag := range HTML_LINK_TAG_REGEX.FindAll(htmlData, -1) {
+		attrs := make(map[string]string)
+		for _, attr := range HTML_ATTR_REGEX.FindAllSubmatch(tag, -1) {
+			attrs[strings.ToLower(string(attr[1]))] = html.UnescapeString(string(attr[2]))
+		}
+		isFeed := false
+		for _, mimeType := range FEED_MIME_TYPES {
+			isFeed = isFeed || mimeType == strings.ToLower(attrs["type"])
+		}
+		if !isFeed || "" == attrs["href"] || !strings.Contains(strings.ToLower(attrs["rel"]), "alternate") {
+			continue
+		}
+		feedURL, err := pageURL.Parse(attrs["href"])
+		if nil != err {
+			log.Printf("[WARN] invalid feed url %s: %s", attrs["href"], err)
+			continue
+		}
+		feeds = append(feeds, feedURL)
+	}
+	return
+}
+
+// titles of the links grouped by their markup, the groups with more and longer titles first.
+// Links are in the same group if the tags before them are the same except the attributes other
+// than class.
+func GuessIndexTitles(htmlData []byte) (candidates [][]string) {
+	tokens := HTML_TOKEN_REGEX.FindAllString(string(htmlData), -1)
+	groupInds := make(map[string]int)
+	var groups [][]string
+	var scores []int
+	for ind := 2; ind+1 < len(tokens); ind++ {
+		title := strings.TrimSpace(html.UnescapeString(tokens[ind]))
+		if strings.HasPrefix(tokens[ind], "<") || "" == title {
+			continue
+		}
+		if name, closing := HtmlTagName(tokens[ind-1]); "a" != name || closing || !strings.Contains(tokens[ind-1], "href=") {
+			continue
+		}
+		if name, closing := HtmlTagName(tokens[ind+1]); "a" != name || !closing {
+			continue
+		}
+
+		signature := LinkSignature(tokens[ind-2]) + LinkSignature(tokens[ind-1])
+		groupInd, ok := groupInds[signature]
+		if !ok {
+			groupInd = len(groups)
+			groupInds[signature] = groupInd
+			groups = append(groups, nil)
+			scores = append(scores, 0)
+		}
+		duplicate := false
+		for _, t := range groups[groupInd] {
+			duplicate = duplicate || t == title
+		}
+		if !duplicate {
+			groups[groupInd] = append(groups[groupInd], title)
+			scores[groupInd] += utf8.RuneCountInString(title)
+		}
+	}
+
+	var candidateInds []int
+	for ind, titles := range groups {
+		if len(titles) >= INIT_MIN_ENTRIES {
+			candidateInds = append(candidateInds, ind)
+		}
+	}
+	sort.SliceStable(candidateInds, func(i, j int) bool { return scores[candidateInds[i]] > scores[candidateInds[j]] })
+	for _, ind := range candidateInds {
+		candidates = append(candidates, groups[ind])
+	}
+	return
+}
+
+// tag token with the attribute values other than class removed
+func LinkSignature(token string) string {
+	return HTML_ATTR_REGEX.ReplaceAllStringFunc(token, func(attr string) string {
+		match := HTML_ATTR_REGEX.FindStringSubmatch(attr)
+		if "class" == strings.ToLower(match[1]) {
+			return attr
+		}
+		return match[1] + `=""`
+	})
+}
+
+// induce content pattern from the longest text of the article page
+func GuessContentPattern(htmlData []byte) (pat string, err error) {
+	longest := ""
+	for _, token := range HTML_TOKEN_REGEX.FindAllString(string(htmlData), -1) {
+		text := strings.TrimSpace(html.UnescapeString(token))
+		if !strings.HasPrefix(token, "<") && len(text) > len(longest) {
+			longest = text
+		}
+	}
+	if "" == longest {
+		return "", errors.New("no text found in the page")
+	}
+	return InduceContentPattern(htmlData, longest)
+}
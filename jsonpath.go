@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// compile json path like $.data.list[*], $['items'][0].title or title,
+// the leading $ or @ is optional
+func CompileJsonPath(path string) (jsonPath *JsonPath, err error) {
+	path = strings.TrimSpace(path)
+	if "" == path {
+		return
+	}
+
+	jsonPath = &JsonPath{Raw: path}
+	rest := path
+	if strings.HasPrefix(rest, "$") || strings.HasPrefix(rest, "@") {
+		rest = rest[1:]
+	}
+	for "" != rest {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if -1 == end {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if "" == key {
+				return nil, errors.New("empty key in json path " + path)
+			}
+			if "*" == key {
+				jsonPath.Steps = append(jsonPath.Steps, JsonPathStep{Type: JSON_PATH_WILDCARD})
+			} else {
+				jsonPath.Steps = append(jsonPath.Steps, JsonPathStep{Type: JSON_PATH_KEY, Key: key})
+			}
+		case '[':
+			end := strings.Index(rest, "]")
+			if -1 == end {
+				return nil, errors.New("unclosed [ in json path " + path)
+			}
+			sub := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if "*" == sub {
+				jsonPath.Steps = append(jsonPath.Steps, JsonPathStep{Type: JSON_PATH_WILDCARD})
+			} else if 2 <= len(sub) && (('\'' == sub[0] && '\'' == sub[len(sub)-1]) || ('"' == sub[0] && '"' == sub[len(sub)-1])) {
+				jsonPath.Steps = append(jsonPath.Steps, JsonPathStep{Type: JSON_PATH_KEY, Key: sub[1 : len(sub)-1]})
+			} else if index, err := strconv.Atoi(sub); nil == err {
+				jsonPath.Steps = append(jsonPath.Steps, JsonPathStep{Type: JSON_PATH_INDEX, Index: index})
+			} else {
+				return nil, errors.New("invalid subscript [" + sub + "] in json path " + path)
+			}
+		default:
+			// path without leading $, such as data.list
+			rest = "." + rest
+		}
+	}
+
+	return
+}
+
+func CompileJsonPathRule(ruleConf *ExtractRuleConfig) (rule *JsonPathRule, err error) {
+	if nil == ruleConf {
+		return
+	}
+
+	rule = new(JsonPathRule)
+	paths := []struct {
+		path     string
+		compPath **JsonPath
+	}{
+		{ruleConf.Entry, &rule.Entry},
+		{ruleConf.Title, &rule.Title},
+		{ruleConf.Link, &rule.Link},
+		{ruleConf.Description, &rule.Description},
+		{ruleConf.PubDate, &rule.PubDate},
+	}
+	for _, p := range paths {
+		*p.compPath, err = CompileJsonPath(p.path)
+		if nil != err {
+			log.Printf("[ERROR] error compiling json path %s: %s", p.path, err)
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// select all the values matched by the json path, data is decoded by encoding/json
+func (jsonPath *JsonPath) Select(data interface{}) []interface{} {
+	values := []interface{}{data}
+	for _, step := range jsonPath.Steps {
+		var next []interface{}
+		for _, value := range values {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				if JSON_PATH_WILDCARD == step.Type {
+					// go maps are not ordered, values of the object are selected in the order of keys
+					keys := make([]string, 0, len(v))
+					for key := range v {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, v[key])
+					}
+				} else if JSON_PATH_KEY == step.Type {
+					if child, ok := v[step.Key]; ok {
+						next = append(next, child)
+					}
+				}
+			case []interface{}:
+				if JSON_PATH_WILDCARD == step.Type {
+					next = append(next, v...)
+				} else if JSON_PATH_INDEX == step.Type {
+					index := step.Index
+					if 0 > index {
+						index += len(v)
+					}
+					if 0 <= index && index < len(v) {
+						next = append(next, v[index])
+					}
+				}
+			}
+		}
+		values = next
+	}
+
+	return values
+}
+
+// strings are returned as they are, objects and arrays are encoded as json
+func JsonValueToBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(strings.TrimSpace(v))
+	case json.Number:
+		return []byte(v.String())
+	case bool:
+		return []byte(strconv.FormatBool(v))
+	}
+
+	data, err := json.Marshal(value)
+	if nil != err {
+		return nil
+	}
+	return data
+}
+
+// extract entries from json api with Feed.IndexJsonPath
+type JsonExtractor struct {
+	feedTar *FeedTarget
+}
+
+func NewJsonExtractor(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error) {
+	return &JsonExtractor{feedTar: feedTar}, nil
+}
+
+// html minification changes the string values of json
+func (ext *JsonExtractor) RawData() bool {
+	return true
+}
+
+func (ext *JsonExtractor) ExtractIndex(feed *Feed, indexURL *url.URL, htmlData []byte) (entries []*FeedEntry, err error) {
+	feedTar := ext.feedTar
+	rule := feedTar.IndexJsonPath
+	if nil == rule {
+		return nil, errors.New("Feed.IndexJsonPath not defined")
+	}
+
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(htmlData))
+	// keep big integers such as ids and timestamps
+	decoder.UseNumber()
+	if err = decoder.Decode(&data); nil != err {
+		return
+	}
+
+	entryValues := rule.Entry.Select(data)
+	if 0 == len(entryValues) {
+		return nil, errors.New("json path " + rule.Entry.Raw + " selected nothing")
+	}
+
+	fields := []struct {
+		path *JsonPath
+		name string
+	}{
+		{rule.Title, PATTERN_TITLE},
+		{rule.Link, PATTERN_LINK},
+		{rule.Description, PATTERN_CONTENT},
+		{rule.PubDate, PATTERN_PUBDATE},
+	}
+	for _, entryValue := range entryValues {
+		entry := new(FeedEntry)
+		for _, field := range fields {
+			if nil == field.path {
+				continue
+			}
+			values := field.path.Select(entryValue)
+			if 0 == len(values) || nil == values[0] {
+				log.Printf("[WARN] failed to extract %s from json %s: json path %s selected nothing", field.name, indexURL.String(), field.path.Raw)
+				continue
+			}
+			SetEntryField(feedTar, feed, entry, indexURL, field.name, JsonValueToBytes(values[0]))
+		}
+		entries = append(entries, entry)
+	}
+
+	return
+}
+
+func (ext *JsonExtractor) ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (EntryFields, error) {
+	return nil, errors.New("json extractor can only be used for index pages")
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp/syntax"
+	"strings"
+)
+
+func (err *PatternError) Error() string {
+	return fmt.Sprintf("%s at %d", err.Msg, err.Pos)
+}
+
+func (issue PatternIssue) String() string {
+	msg := "[" + issue.Level + "] "
+	if "" != issue.Target {
+		msg += "feed target " + issue.Target + ", "
+	}
+	msg += issue.Key
+	if 0 <= issue.Pos {
+		msg += fmt.Sprintf(" at offset %d", issue.Pos)
+	}
+	return msg + ": " + issue.Message
+}
+
+func newPatternIssue(level, key string, pos int, format string, args ...interface{}) PatternIssue {
+	return PatternIssue{Level: level, Key: key, Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// key of the ind-th item of a config list, Feed.IndexPattern[1] for example
+func PatternKey(key string, ind int) string {
+	return fmt.Sprintf("%s[%d]", key, ind)
+}
+
+// title or feed path of target, used in lint messages
+func TargetName(tar *TargetConfig) string {
+	if name := FirstNonEmpty(tar.Title, tar.FeedPath); "" != name {
+		return name
+	}
+	if 0 != len(tar.Outputs) {
+		return tar.Outputs[0].Path
+	}
+	return ""
+}
+
+// print issues, return false if there is any error
+func LogPatternIssues(issues []PatternIssue) (ok bool) {
+	ok = true
+	for _, issue := range issues {
+		log.Print(issue.String())
+		if LINT_ERROR == issue.Level {
+			ok = false
+		}
+	}
+	return
+}
+
+// offset of the regex syntax error in the pattern, which is the first text token failing with the same error.
+// The error of the compiled pattern may not be found in the pattern, -1 is returned then.
+func RegexErrorPos(tokens []PatternToken, regErr *syntax.Error) int {
+	for _, token := range tokens {
+		if PATTERN_TOKEN_TEXT != token.Type {
+			continue
+		}
+		_, err := syntax.Parse(token.Text, syntax.Perl)
+		if tokenErr, ok := err.(*syntax.Error); ok && regErr.Code == tokenErr.Code && regErr.Expr == tokenErr.Expr {
+			if ind := strings.Index(token.Text, regErr.Expr); -1 != ind {
+				return token.Pos + ind
+			}
+		}
+	}
+	return -1
+}
+
+// check syntax and common pitfalls of pattern, fields are the custom fields applied to it
+func LintPattern(key, pat string, fields map[string]string) (issues []PatternIssue) {
+	tokens, err := TokenizePattern(pat)
+	if nil != err {
+		if patErr, ok := err.(*PatternError); ok {
+			return append(issues, newPatternIssue(LINT_ERROR, key, patErr.Pos, "%s", patErr.Msg))
+		}
+		return append(issues, newPatternIssue(LINT_ERROR, key, -1, "%s", err))
+	}
+
+	if _, err = CompilePattern(pat, fields); nil != err {
+		pos := -1
+		if regErr, ok := err.(*syntax.Error); ok {
+			pos = RegexErrorPos(tokens, regErr)
+		}
+		issues = append(issues, newPatternIssue(LINT_ERROR, key, pos, "invalid regex: %s", err))
+	}
+
+	// leading {any} is matched from the beginning of the page or the end of last match,
+	// and trailing {any} is non-greedy, which always matches nothing
+	if 0 != len(tokens) && IsAnyToken(tokens[0]) {
+		issues = append(issues, newPatternIssue(LINT_WARN, key, 0, "leading %s matches everything before the pattern, remove it", PATTERN_ANY))
+	}
+	if last := len(tokens) - 1; 0 < last && IsAnyToken(tokens[last]) {
+		issues = append(issues, newPatternIssue(LINT_WARN, key, tokens[last].Pos, "trailing %s always matches an empty string, remove it", PATTERN_ANY))
+	}
+
+	// placeholders in the blocks with alternatives may be duplicate, such as [[<b>{title}</b>||<i>{title}</i>]]
+	altBlocks := make(map[int]bool)
+	var blockStarts []int
+	for ind, token := range tokens {
+		switch token.Type {
+		case PATTERN_TOKEN_OPTIONAL_START:
+			blockStarts = append(blockStarts, ind)
+		case PATTERN_TOKEN_ALTERNATIVE:
+			altBlocks[blockStarts[len(blockStarts)-1]] = true
+		case PATTERN_TOKEN_OPTIONAL_END:
+			blockStarts = blockStarts[:len(blockStarts)-1]
+		}
+	}
+
+	fieldPos := make(map[string]int)
+	var inAlt []bool
+	for ind, token := range tokens {
+		field := ""
+		switch token.Type {
+		case PATTERN_TOKEN_OPTIONAL_START:
+			inAlt = append(inAlt, altBlocks[ind] || (0 != len(inAlt) && inAlt[len(inAlt)-1]))
+			continue
+		case PATTERN_TOKEN_OPTIONAL_END:
+			inAlt = inAlt[:len(inAlt)-1]
+			continue
+		case PATTERN_TOKEN_FIELD:
+			field = token.Name
+			if mapped, ok := fields[field]; ok {
+				field = mapped
+			}
+			if _, ok := PredefinedPatternRegex(field); !ok {
+				issues = append(issues, newPatternIssue(LINT_WARN, key, token.Pos, "unknown placeholder %s is matched literally", token.Text))
+				continue
+			}
+		case PATTERN_TOKEN_ATTR:
+			if "" == token.Field {
+				continue
+			}
+			field = token.Field
+			if mapped, ok := fields[field]; ok {
+				field = mapped
+			}
+			if _, ok := PredefinedPatternRegex(field); !ok {
+				issues = append(issues, newPatternIssue(LINT_WARN, key, token.Pos, "unknown field %s of %s is ignored", token.Field, token.Text))
+				continue
+			}
+		default:
+			continue
+		}
+
+		// multiple categories are allowed, {any}, {int}, {text} and {ws} are not captured
+		switch field {
+		case PATTERN_CATEGORY, PATTERN_ANY_NAME, PATTERN_INT, PATTERN_TEXT, PATTERN_WS:
+			continue
+		}
+		if 0 != len(inAlt) && inAlt[len(inAlt)-1] {
+			continue
+		}
+		if firstPos, ok := fieldPos[field]; ok {
+			issues = append(issues, newPatternIssue(LINT_WARN, key, token.Pos, "duplicate placeholder %s, the first one is at offset %d", GenPDPName(field), firstPos))
+		} else {
+			fieldPos[field] = token.Pos
+		}
+	}
+
+	return
+}
+
+func IsAnyToken(token PatternToken) bool {
+	return PATTERN_TOKEN_FIELD == token.Type && PATTERN_ANY_NAME == token.Name
+}
+
+// check that pattern contains [min, max] placeholders of each field, max < 0 means no limit
+func LintPatternFields(key, pat string, min, max int, fields ...string) (issues []PatternIssue) {
+	for _, field := range fields {
+		count := CountPatternField(pat, field)
+		if 0 > count {
+			// syntax errors are reported by LintPattern
+			return
+		}
+		if count >= min && (0 > max || count <= max) {
+			continue
+		}
+		switch {
+		case 0 == max:
+			issues = append(issues, newPatternIssue(LINT_ERROR, key, -1, "should not contain %s, found %d", GenPDPName(field), count))
+		case min == max:
+			issues = append(issues, newPatternIssue(LINT_ERROR, key, -1, "should contain %d %s, found %d", min, GenPDPName(field), count))
+		case 0 > max:
+			issues = append(issues, newPatternIssue(LINT_ERROR, key, -1, "should contain at least %d %s, found %d", min, GenPDPName(field), count))
+		default:
+			issues = append(issues, newPatternIssue(LINT_ERROR, key, -1, "should contain %d to %d %s, found %d", min, max, GenPDPName(field), count))
+		}
+	}
+	return
+}
+
+// pubdate pattern should contain 1 {month} and 1 {day}, {year} is the current year if missing,
+// and it should not contain fields other than dates
+func LintPubDatePattern(key, pat string) (issues []PatternIssue) {
+	issues = LintPattern(key, pat, nil)
+	// dates without month or day are still parsed, which may be wrong
+	for _, issue := range LintPatternFields(key, pat, 1, 1, PATTERN_MONTH, PATTERN_DAY) {
+		issue.Level = LINT_WARN
+		issues = append(issues, issue)
+	}
+
+	tokens, err := TokenizePattern(pat)
+	if nil != err {
+		return
+	}
+	for _, token := range tokens {
+		field := token.Name
+		if PATTERN_TOKEN_ATTR == token.Type {
+			field = token.Field
+		} else if PATTERN_TOKEN_FIELD != token.Type {
+			continue
+		}
+		switch field {
+		case "", PATTERN_YEAR, PATTERN_MONTH, PATTERN_DAY, PATTERN_HOUR, PATTERN_MINUTE, PATTERN_SECOND,
+			PATTERN_ANY_NAME, PATTERN_INT, PATTERN_TEXT, PATTERN_WS:
+			continue
+		}
+		if _, ok := PredefinedPatternRegex(field); ok {
+			issues = append(issues, newPatternIssue(LINT_WARN, key, token.Pos, "%s is not a date field and is ignored", GenPDPName(field)))
+		}
+	}
+	return
+}
+
+// custom field names should be valid regex group names and should not be pre-defined,
+// and they can only be mapped to {author}, {category}, {image} or {summary}
+func LintCustomFields(fields map[string]string) (issues []PatternIssue) {
+	for name, field := range fields {
+		key := "Feed.Fields." + name
+		if _, predefined := PredefinedPatternRegex(name); predefined || !CUSTOM_FIELD_NAME_REGEX.MatchString(name) {
+			issues = append(issues, newPatternIssue(LINT_ERROR, key, -1, "invalid custom field name %s", name))
+			continue
+		}
+		switch field {
+		case PATTERN_AUTHOR, PATTERN_CATEGORY, PATTERN_IMAGE, PATTERN_SUMMARY:
+		default:
+			issues = append(issues, newPatternIssue(LINT_ERROR, key, -1, "should be mapped to %s, %s, %s or %s", PATTERN_AUTHOR, PATTERN_CATEGORY, PATTERN_IMAGE, PATTERN_SUMMARY))
+		}
+	}
+	return
+}
+
+// Feed.Index{XPath,Selector,JsonPath} must contain Entry, Title and Link
+// Feed.Content{XPath,Selector} must contain Description
+func LintExtractRules(tar *TargetConfig, ruleType string, indexRule, contentRule *ExtractRuleConfig) (issues []PatternIssue) {
+	indexKey := "Feed.Index" + ruleType
+	contentKey := "Feed.Content" + ruleType
+
+	if nil != indexRule {
+		if 0 != len(tar.IndexPatterns) || 0 != len(tar.IndexFilterPatterns) {
+			issues = append(issues, newPatternIssue(LINT_ERROR, indexKey, -1, "cannot be used together with Feed.IndexPattern or Feed.IndexFilterPattern"))
+		}
+		if "" == indexRule.Entry || "" == indexRule.Title || "" == indexRule.Link {
+			issues = append(issues, newPatternIssue(LINT_ERROR, indexKey, -1, "should contain Entry, Title and Link"))
+		}
+	}
+
+	if nil != contentRule {
+		if 0 != len(tar.ContentPatterns) || 0 != len(tar.ContentFilterPatterns) {
+			issues = append(issues, newPatternIssue(LINT_ERROR, contentKey, -1, "cannot be used together with Feed.ContentPattern or Feed.ContentFilterPattern"))
+		}
+		if "" == contentRule.Description {
+			issues = append(issues, newPatternIssue(LINT_ERROR, contentKey, -1, "should contain Description"))
+		}
+		if "" != contentRule.Entry || "" != contentRule.Title || "" != contentRule.Link {
+			issues = append(issues, newPatternIssue(LINT_WARN, contentKey, -1, "Entry, Title and Link will be ignored"))
+		}
+	}
+
+	return
+}
+
+// lint all the patterns and extract rules of target
+// IndexPattern must contain both {title} and {link}
+// ContentPattern must contain {content}
+func LintPatterns(tar *TargetConfig) (issues []PatternIssue) {
+	issues = append(issues, LintExtractRules(tar, "XPath", tar.IndexXPath, tar.ContentXPath)...)
+	issues = append(issues, LintExtractRules(tar, "Selector", tar.IndexSelector, tar.ContentSelector)...)
+	issues = append(issues, LintExtractRules(tar, "JsonPath", tar.IndexJsonPath, nil)...)
+
+	indexRuleCount := 0
+	for _, rule := range []*ExtractRuleConfig{tar.IndexXPath, tar.IndexSelector, tar.IndexJsonPath} {
+		if nil != rule {
+			indexRuleCount += 1
+		}
+	}
+	if 1 < indexRuleCount {
+		issues = append(issues, newPatternIssue(LINT_ERROR, "Feed.IndexXPath", -1, "xpath, css selector and json path cannot be used together for index html"))
+	}
+	if nil != tar.ContentXPath && nil != tar.ContentSelector {
+		issues = append(issues, newPatternIssue(LINT_ERROR, "Feed.ContentXPath", -1, "xpath and css selector cannot be used together for content html"))
+	}
+
+	issues = append(issues, LintCustomFields(tar.Fields)...)
+
+	// patterns are not required by other extractors
+	indexRuleMode := 0 != indexRuleCount || ("" != tar.Mode && EXTRACTOR_PATTERN != strings.ToLower(tar.Mode))
+	contentRuleMode := ContentRuleMode(tar)
+	if indexRuleMode && 1 < len(tar.ContentPatterns) {
+		issues = append(issues, newPatternIssue(LINT_ERROR, "Feed.ContentPattern", -1, "there should be only one pattern when index pages are not extracted with Feed.IndexPattern"))
+	}
+
+	// one pattern for all the urls, or one for each url
+	if !indexRuleMode && len(tar.URLs) != len(tar.IndexPatterns) && 1 != len(tar.IndexPatterns) && 1 != len(tar.URLs) {
+		issues = append(issues, newPatternIssue(LINT_ERROR, "Feed.IndexPattern", -1, "there should be 1 or %d patterns, the same as Feed.URL, found %d", len(tar.URLs), len(tar.IndexPatterns)))
+	}
+	if !contentRuleMode && len(tar.URLs) != len(tar.ContentPatterns) && 1 != len(tar.ContentPatterns) && 1 != len(tar.URLs) {
+		issues = append(issues, newPatternIssue(LINT_ERROR, "Feed.ContentPattern", -1, "there should be 1 or %d patterns, the same as Feed.URL, found %d", len(tar.URLs), len(tar.ContentPatterns)))
+	}
+	if pubDateNum := len(tar.PubDatePatterns); 0 != pubDateNum && 1 != pubDateNum && len(tar.URLs) != pubDateNum {
+		issues = append(issues, newPatternIssue(LINT_ERROR, "Feed.PubDatePattern", -1, "there should be 0, 1 or %d patterns, the same as Feed.URL, found %d", len(tar.URLs), pubDateNum))
+	}
+
+	// IndexPattern should contain both {title} and {link}
+	for ind, pat := range tar.IndexPatterns {
+		key := PatternKey("Feed.IndexPattern", ind)
+		if "" == pat {
+			issues = append(issues, newPatternIssue(LINT_ERROR, key, -1, "pattern is empty"))
+			continue
+		}
+		issues = append(issues, LintPattern(key, pat, tar.Fields)...)
+		issues = append(issues, LintPatternFields(key, pat, 1, 1, PATTERN_TITLE, PATTERN_LINK)...)
+	}
+
+	// ContentPattern should contain {content} and should not contain {title} nor {link}
+	for ind, pat := range tar.ContentPatterns {
+		key := PatternKey("Feed.ContentPattern", ind)
+		if "" == pat {
+			issues = append(issues, newPatternIssue(LINT_ERROR, key, -1, "pattern is empty"))
+			continue
+		}
+		issues = append(issues, LintPattern(key, pat, tar.Fields)...)
+		issues = append(issues, LintPatternFields(key, pat, 1, 1, PATTERN_CONTENT)...)
+		issues = append(issues, LintPatternFields(key, pat, 0, 0, PATTERN_TITLE, PATTERN_LINK)...)
+	}
+
+	// filter patterns should be empty or contain {filter}
+	if 0 != len(tar.IndexFilterPatterns) && len(tar.IndexFilterPatterns) != len(tar.IndexPatterns) {
+		issues = append(issues, newPatternIssue(LINT_ERROR, "Feed.IndexFilterPattern", -1, "there should be 0 or %d patterns, the same as Feed.IndexPattern, found %d", len(tar.IndexPatterns), len(tar.IndexFilterPatterns)))
+	}
+	if 0 != len(tar.ContentFilterPatterns) && len(tar.ContentFilterPatterns) != len(tar.ContentPatterns) {
+		issues = append(issues, newPatternIssue(LINT_ERROR, "Feed.ContentFilterPattern", -1, "there should be 0 or %d patterns, the same as Feed.ContentPattern, found %d", len(tar.ContentPatterns), len(tar.ContentFilterPatterns)))
+	}
+	for ind, pat := range tar.IndexFilterPatterns {
+		if "" != pat {
+			key := PatternKey("Feed.IndexFilterPattern", ind)
+			issues = append(issues, LintPattern(key, pat, nil)...)
+			issues = append(issues, LintPatternFields(key, pat, 1, -1, PATTERN_FILTER)...)
+		}
+	}
+	for ind, pat := range tar.ContentFilterPatterns {
+		if "" != pat {
+			key := PatternKey("Feed.ContentFilterPattern", ind)
+			issues = append(issues, LintPattern(key, pat, nil)...)
+			issues = append(issues, LintPatternFields(key, pat, 1, -1, PATTERN_FILTER)...)
+		}
+	}
+
+	for ind, pat := range tar.PubDatePatterns {
+		if "" != strings.TrimSpace(pat) {
+			issues = append(issues, LintPubDatePattern(PatternKey("Feed.PubDatePattern", ind), pat)...)
+		}
+	}
+
+	// next page patterns should contain {link} only
+	for _, nextPage := range [][2]string{{"Feed.NextPagePattern", tar.NextPagePattern}, {"Feed.ContentNextPagePattern", tar.ContentNextPagePattern}} {
+		if "" != nextPage[1] {
+			issues = append(issues, LintPattern(nextPage[0], nextPage[1], nil)...)
+			issues = append(issues, LintPatternFields(nextPage[0], nextPage[1], 1, 1, PATTERN_LINK)...)
+		}
+	}
+
+	// navigation pattern should contain 1 {link}, and may contain {title} or {pubdate}
+	for ind, nav := range tar.Navigation {
+		key := PatternKey("Feed.Navigation", ind)
+		issues = append(issues, LintPattern(key+".Pattern", nav.Pattern, tar.Fields)...)
+		issues = append(issues, LintPatternFields(key+".Pattern", nav.Pattern, 1, 1, PATTERN_LINK)...)
+		issues = append(issues, LintPatternFields(key+".Pattern", nav.Pattern, 0, 1, PATTERN_TITLE)...)
+		issues = append(issues, LintPatternFields(key+".Pattern", nav.Pattern, 0, 0, PATTERN_CONTENT)...)
+		if "" != nav.FilterPattern {
+			issues = append(issues, LintPattern(key+".FilterPattern", nav.FilterPattern, nil)...)
+			issues = append(issues, LintPatternFields(key+".FilterPattern", nav.FilterPattern, 1, -1, PATTERN_FILTER)...)
+		}
+	}
+
+	name := TargetName(tar)
+	for ind := range issues {
+		issues[ind].Target = name
+	}
+	return
+}
+
+// true if content pages of tar are not extracted with Feed.ContentPattern
+func ContentRuleMode(tar *TargetConfig) bool {
+	return nil != tar.ContentXPath || nil != tar.ContentSelector || ("" != tar.ContentMode && EXTRACTOR_PATTERN != strings.ToLower(tar.ContentMode)) ||
+		(EXTRACTOR_HFEED == strings.ToLower(tar.Mode) && 0 == len(tar.ContentPatterns))
+}
+
+// content pages cannot be extracted without Feed.ContentPattern, other content rules or Feed.ContentFallback.
+// It is not checked by LintPatterns, as gofeed test and the web ui try index patterns before content ones.
+func LintContentRules(tar *TargetConfig) (issues []PatternIssue) {
+	if 0 == len(tar.ContentPatterns) && !ContentRuleMode(tar) && "" == strings.TrimSpace(tar.ContentFallback) {
+		issue := newPatternIssue(LINT_ERROR, "Feed.ContentPattern", -1, "not defined, Feed.ContentFallback should be set to extract content pages without it")
+		issue.Target = TargetName(tar)
+		issues = append(issues, issue)
+	}
+	return
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"log"
+	"strings"
+)
+
+// title, pubdate, author and image of the article in htmlData, read from the json-ld
+// Article blocks first, then the opengraph and article meta tags
+func ExtractMetadata(htmlData []byte) (meta EntryFields) {
+	meta = ExtractJsonLdMetadata(htmlData)
+	for field, value := range ExtractMetaTagMetadata(htmlData) {
+		if 0 == len(meta[field]) {
+			meta[field] = value
+		}
+	}
+	return
+}
+
+func ExtractJsonLdMetadata(htmlData []byte) (meta EntryFields) {
+	meta = make(EntryFields)
+	for _, match := range JSONLD_SCRIPT_REGEX.FindAllSubmatch(htmlData, -1) {
+		var value interface{}
+		if err := json.Unmarshal(match[1], &value); nil != err {
+			log.Printf("[WARN] failed to parse json-ld: %s", err)
+			continue
+		}
+		article := FindJsonLdArticle(value)
+		if nil == article {
+			continue
+		}
+		for _, field := range []struct {
+			name, key, nameKey string
+		}{
+			{PATTERN_TITLE, "headline", ""},
+			{PATTERN_PUBDATE, "datePublished", ""},
+			{PATTERN_AUTHOR, "author", "name"},
+			{PATTERN_IMAGE, "image", "url"},
+		} {
+			if text := JsonLdText(article[field.key], field.nameKey); "" != text && 0 == len(meta[field.name]) {
+				meta[field.name] = []byte(text)
+			}
+		}
+	}
+	return
+}
+
+// the first object whose @type is an article, such as Article, NewsArticle or BlogPosting.
+// Arrays and @graph are searched.
+func FindJsonLdArticle(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if article := FindJsonLdArticle(item); nil != article {
+				return article
+			}
+		}
+	case map[string]interface{}:
+		types, _ := v["@type"].([]interface{})
+		if t, ok := v["@type"].(string); ok {
+			types = append(types, t)
+		}
+		for _, t := range types {
+			if t, ok := t.(string); ok && JSONLD_ARTICLE_TYPE_REGEX.MatchString(t) {
+				return v
+			}
+		}
+		return FindJsonLdArticle(v["@graph"])
+	}
+	return nil
+}
+
+// value if it is a string, value[nameKey] if it is an object, or the text of the first item
+// if it is an array
+func JsonLdText(value interface{}, nameKey string) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		if "" != nameKey {
+			return JsonLdText(v[nameKey], "")
+		}
+	case []interface{}:
+		if 0 != len(v) {
+			return JsonLdText(v[0], nameKey)
+		}
+	}
+	return ""
+}
+
+// fields of METADATA_META_FIELDS in the meta tags
+func ExtractMetaTagMetadata(htmlData []byte) (meta EntryFields) {
+	meta = make(EntryFields)
+	for _, tag := range HTML_META_TAG_REGEX.FindAll(htmlData, -1) {
+		attrs := make(map[string]string)
+		for _, attr := range HTML_ATTR_REGEX.FindAllSubmatch(tag, -1) {
+			attrs[strings.ToLower(string(attr[1]))] = strings.TrimSpace(string(attr[2]))
+		}
+		name := attrs["property"]
+		if "" == name {
+			name = attrs["name"]
+		}
+		field, ok := METADATA_META_FIELDS[strings.ToLower(name)]
+		// article:author is the url of the author page on some sites
+		if !ok || "" == attrs["content"] || 0 != len(meta[field]) ||
+			(PATTERN_AUTHOR == field && strings.Contains(attrs["content"], "://")) {
+			continue
+		}
+		meta[field] = []byte(attrs["content"])
+	}
+	return
+}
+
+// fill the empty title, pubdate, author and image of entry with the metadata of its content page,
+// return names of the filled fields
+func ApplyMetadata(entry *FeedEntry, htmlData []byte) (filled []string) {
+	meta := ExtractMetadata(htmlData)
+	if title := meta[PATTERN_TITLE]; "" == entry.Title && 0 != len(title) {
+		entry.Title = html.UnescapeString(string(title))
+		filled = append(filled, PATTERN_TITLE)
+	}
+	if author := meta[PATTERN_AUTHOR]; "" == entry.Author && 0 != len(author) {
+		entry.Author = html.UnescapeString(string(author))
+		filled = append(filled, PATTERN_AUTHOR)
+	}
+	if pubDate := meta[PATTERN_PUBDATE]; nil == entry.PubDate && 0 != len(pubDate) {
+		if date, err := ParseStandardTime(string(pubDate)); nil != err {
+			log.Printf("[WARN] failed to parse pubdate %s in metadata of %s: %s", pubDate, entry.Link, err)
+		} else {
+			entry.PubDate = &date
+			filled = append(filled, PATTERN_PUBDATE)
+		}
+	}
+	if image := meta[PATTERN_IMAGE]; nil == entry.Image && 0 != len(image) && nil != entry.Link {
+		if imageURL, err := entry.Link.Parse(html.UnescapeString(string(image))); nil != err {
+			log.Printf("[WARN] failed to parse image %s in metadata of %s: %s", image, entry.Link, err)
+		} else {
+			entry.Image = imageURL
+			filled = append(filled, PATTERN_IMAGE)
+		}
+	}
+	return
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// extract microformats2 h-entry items, used for both the index and content pages in Feed.Mode "h-feed".
+// Entries of the index page are read from p-name, u-url, dt-published and other properties of the
+// h-entry items, e-content or p-summary is the partial description. The description is replaced
+// with e-content of the permalink page.
+type HFeedExtractor struct {
+	feedTar *FeedTarget
+}
+
+func NewHFeedExtractor(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error) {
+	return &HFeedExtractor{feedTar: feedTar}, nil
+}
+
+func (ext *HFeedExtractor) ExtractIndex(feed *Feed, indexURL *url.URL, htmlData []byte) (entries []*FeedEntry, err error) {
+	doc, err := ParseHtmlDom(htmlData)
+	if nil != err {
+		return
+	}
+
+	for _, node := range FindMicroformats(doc, MF2_ENTRY_CLASS) {
+		fields := Mf2EntryFields(ParseMf2Properties(node))
+		if 0 == len(fields[PATTERN_LINK]) {
+			fields[PATTERN_LINK] = []byte(Mf2ImpliedURL(node))
+		}
+		if 0 == len(fields[PATTERN_LINK]) {
+			log.Printf("[WARN] h-entry without u-url in %s is ignored", indexURL.String())
+			continue
+		}
+
+		entry := new(FeedEntry)
+		for fieldName, value := range fields {
+			if PATTERN_CONTENT != fieldName {
+				SetEntryField(ext.feedTar, feed, entry, indexURL, fieldName, value)
+			}
+		}
+		// partial description is used if the permalink page has no e-content
+		if content := fields[PATTERN_CONTENT]; 0 != len(content) {
+			entry.Content = content
+		} else {
+			entry.Content = fields[PATTERN_SUMMARY]
+		}
+		entries = append(entries, entry)
+	}
+
+	if 0 == len(entries) {
+		err = errors.New("no h-entry found")
+	} else if *gVerbose {
+		log.Printf("found %d h-entry items in %s", len(entries), indexURL.String())
+	}
+	return
+}
+
+func (ext *HFeedExtractor) ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (fields EntryFields, err error) {
+	doc, err := ParseHtmlDom(htmlData)
+	if nil != err {
+		return
+	}
+	nodes := FindMicroformats(doc, MF2_ENTRY_CLASS)
+	if 0 == len(nodes) {
+		return nil, errors.New("no h-entry found")
+	}
+
+	// permalink pages may list other h-entry items, such as replies, use the one of entry link
+	fields = Mf2EntryFields(ParseMf2Properties(nodes[0]))
+	for _, node := range nodes {
+		nodeFields := Mf2EntryFields(ParseMf2Properties(node))
+		if link, linkErr := entry.Link.Parse(string(nodeFields[PATTERN_LINK])); nil == linkErr &&
+			0 != len(nodeFields[PATTERN_LINK]) && entry.Link.String() == link.String() {
+			fields = nodeFields
+			break
+		}
+	}
+	// title and link of the index page are kept
+	delete(fields, PATTERN_TITLE)
+	delete(fields, PATTERN_LINK)
+	return
+}
+
+// the outermost nodes with the root class, such as h-entry. Nested ones are not searched.
+func FindMicroformats(node *html.Node, class string) (nodes []*html.Node) {
+	for child := node.FirstChild; nil != child; child = child.NextSibling {
+		if html.ElementNode != child.Type {
+			continue
+		}
+		if StringInSlice(class, strings.Fields(NodeAttr(child, "class"))) {
+			nodes = append(nodes, child)
+		} else {
+			nodes = append(nodes, FindMicroformats(child, class)...)
+		}
+	}
+	return
+}
+
+// property class -> values of the microformat root. Properties of the nested microformats, such as
+// the h-card of p-author, belong to them, and their values are their p-name.
+func ParseMf2Properties(root *html.Node) (props map[string][]string) {
+	props = make(map[string][]string)
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; nil != child; child = child.NextSibling {
+			if html.ElementNode != child.Type {
+				continue
+			}
+			classes := strings.Fields(NodeAttr(child, "class"))
+			nested := false
+			for _, class := range classes {
+				nested = nested || MF2_ROOT_CLASS_REGEX.MatchString(class)
+			}
+			for _, class := range classes {
+				if !MF2_PROPERTY_CLASS_REGEX.MatchString(class) {
+					continue
+				}
+				if value := Mf2PropertyValue(child, class, nested); "" != value {
+					props[class] = append(props[class], value)
+				}
+			}
+			if !nested {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+	return
+}
+
+// value of the property class of node, see MF2_VALUE_ATTRS
+func Mf2PropertyValue(node *html.Node, class string, nested bool) string {
+	prefix := class[:strings.Index(class, "-")+1]
+	if "e-" == prefix {
+		return strings.TrimSpace(htmlquery.OutputHTML(node, false))
+	}
+	if nested {
+		if names := ParseMf2Properties(node)["p-name"]; 0 != len(names) {
+			return names[0]
+		}
+	} else if attr, ok := MF2_VALUE_ATTRS[prefix][node.Data]; ok {
+		if value := strings.TrimSpace(NodeAttr(node, attr)); "" != value {
+			return value
+		}
+	}
+	return strings.Join(strings.Fields(htmlquery.InnerText(node)), " ")
+}
+
+// fields of the h-entry properties, see MF2_ENTRY_PROPERTIES
+func Mf2EntryFields(props map[string][]string) (fields EntryFields) {
+	fields = make(EntryFields)
+	for fieldName, names := range MF2_ENTRY_PROPERTIES {
+		for _, name := range names {
+			values := props[name]
+			if 0 == len(values) {
+				continue
+			}
+			if PATTERN_CATEGORY == fieldName {
+				fields[fieldName] = []byte(strings.Join(values, ","))
+			} else {
+				fields[fieldName] = []byte(values[0])
+			}
+			break
+		}
+	}
+	return
+}
+
+// implied u-url of the microformat root, which is the root itself if it is a link, or its only link child
+func Mf2ImpliedURL(root *html.Node) string {
+	if "a" == root.Data || "area" == root.Data {
+		return NodeAttr(root, "href")
+	}
+	var link *html.Node
+	for child := root.FirstChild; nil != child; child = child.NextSibling {
+		if html.ElementNode != child.Type || "a" != child.Data {
+			continue
+		}
+		if nil != link {
+			return ""
+		}
+		link = child
+	}
+	if nil == link {
+		return ""
+	}
+	return NodeAttr(link, "href")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// follow Feed.Navigation steps, each step replaces feed entries with the links
+// extracted from their pages, entries of the last step are the articles
+func ParseNavigation(feedTar *FeedTarget, feed *Feed) (ok bool) {
+	if nil == feed {
+		return false
+	}
+
+	for stepInd, step := range feedTar.Navigation {
+		var nextEntries []*FeedEntry
+		// pages may be linked more than once, crawl and add them only once
+		visitedLinks := make(map[string]bool)
+		for _, entry := range feed.Entries {
+			if nil == entry || nil == entry.Link || visitedLinks[entry.Link.String()] {
+				continue
+			}
+			visitedLinks[entry.Link.String()] = true
+
+			for _, nextEntry := range ParseNavigationStep(feedTar, feed, step, entry) {
+				if !visitedLinks[nextEntry.Link.String()] {
+					nextEntries = append(nextEntries, nextEntry)
+				}
+			}
+		}
+
+		if *gVerbose {
+			log.Printf("navigation step %d of %s: %d pages -> %d pages", stepInd+1, feedTar.FeedPath, len(feed.Entries), len(nextEntries))
+		}
+		feed.Entries = nextEntries
+	}
+
+	return true
+}
+
+// extract next level links from the page of entry, title, pubdate and other fields
+// are inherited from entry if not extracted
+func ParseNavigationStep(feedTar *FeedTarget, feed *Feed, step *NavigationStep, entry *FeedEntry) (nextEntries []*FeedEntry) {
+	if *gVerbose {
+		log.Printf("waiting for %d seconds before sending request to %s", feedTar.ReqInterval, entry.Link.String())
+	}
+	time.Sleep(feedTar.ReqInterval * time.Second)
+
+	cache, err := FetchHtml(entry.Link, feedTar)
+	if nil == cache || nil != err {
+		log.Printf("[ERROR] failed to download navigation page %s, will remove this entry", entry.Link.String())
+		return
+	}
+
+	pageData := MinifyHtml(RemoveJunkContent(cache.Html))
+	htmlData := pageData
+	if nil != step.FilterReg {
+		htmlData = RegexpFilter(step.FilterReg, htmlData)
+		if nil == htmlData {
+			log.Printf("[ERROR] navigation filter pattern did not match %s", entry.Link.String())
+			TraceFailedRegex(entry.Link.String(), step.FilterReg, nil, pageData, nil)
+			return
+		}
+	}
+
+	matches := step.Reg.FindAllSubmatch(htmlData, -1)
+	if nil == matches {
+		log.Printf("[ERROR] navigation pattern %s did not match %s", step.Reg.String(), entry.Link.String())
+		TraceFailedRegex(entry.Link.String(), step.Reg, step.FilterReg, pageData, htmlData)
+		return
+	}
+
+	for _, match := range matches {
+		nextEntry := &FeedEntry{
+			IndexPattern: entry.IndexPattern,
+			Title:        entry.Title,
+			PubDate:      entry.PubDate,
+			Categories:   append([]string(nil), entry.Categories...),
+			Author:       entry.Author,
+			Image:        entry.Image,
+			Summary:      entry.Summary,
+		}
+		for patInd, patName := range step.Reg.SubexpNames() {
+			switch patName {
+			case PATTERN_TITLE, PATTERN_LINK, PATTERN_PUBDATE, PATTERN_AUTHOR, PATTERN_CATEGORY, PATTERN_IMAGE, PATTERN_SUMMARY:
+				SetEntryField(feedTar, feed, nextEntry, entry.Link, patName, match[patInd])
+			}
+		}
+		if nil != nextEntry.Link {
+			nextEntries = append(nextEntries, nextEntry)
+		}
+	}
+
+	return
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"log"
 	"regexp"
 	"strconv"
@@ -8,101 +10,208 @@ import (
 	"time"
 )
 
-func PatternToRegex(pat string) string {
-	r := strings.NewReplacer(
-		PATTERN_ANY, PATTERN_ANY_REG,
-		GenPDPName(PATTERN_TITLE), GenPDPRegexStr(PATTERN_TITLE, true, true),
-		GenPDPName(PATTERN_LINK), GenPDPRegexStr(PATTERN_LINK, true, true),
-		GenPDPName(PATTERN_CONTENT), GenPDPRegexStr(PATTERN_CONTENT, false, true),
-		GenPDPName(PATTERN_FILTER), GenPDPRegexStr(PATTERN_FILTER, true, true),
-		GenPDPName(PATTERN_PUBDATE), GenPDPRegexStr(PATTERN_PUBDATE, true, true),
-		GenPDPName(PATTERN_YEAR), GenPDPRegexStr(PATTERN_YEAR, true, true),
-		GenPDPName(PATTERN_MONTH), GenPDPRegexStr(PATTERN_MONTH, true, false),
-		GenPDPName(PATTERN_DAY), GenPDPRegexStr(PATTERN_DAY, true, false),
-		GenPDPName(PATTERN_HOUR), GenPDPRegexStr(PATTERN_HOUR, true, false),
-		GenPDPName(PATTERN_MINUTE), GenPDPRegexStr(PATTERN_MINUTE, true, false),
-		GenPDPName(PATTERN_SECOND), GenPDPRegexStr(PATTERN_SECOND, true, false),
-	)
-
-	return r.Replace(pat)
-}
-
-// IndexPattern must contain both {title} and {link}
-// ContentPattern must contain {content}
-// Either IndexPattern or ContentPattern may contain {pubdate}, but not both.
-func CheckPatterns(tar *TargetConfig) bool {
-	if nil == tar {
-		log.Printf("[ERROR] invliad target, nil")
-		return false
+// regex of pre-defined patterns, return false if name is not pre-defined
+func PredefinedPatternRegex(name string) (regStr string, ok bool) {
+	switch name {
+	case PATTERN_ANY_NAME:
+		return PATTERN_ANY_REG, true
+	case PATTERN_INT:
+		return PATTERN_INT_REG, true
+	case PATTERN_TEXT:
+		return PATTERN_TEXT_REG, true
+	case PATTERN_WS:
+		return PATTERN_WS_REG, true
+	case PATTERN_TITLE, PATTERN_LINK, PATTERN_FILTER, PATTERN_PUBDATE, PATTERN_AUTHOR, PATTERN_CATEGORY, PATTERN_IMAGE, PATTERN_YEAR:
+		return GenPDPRegexStr(name, true, true), true
+	case PATTERN_CONTENT, PATTERN_SUMMARY:
+		return GenPDPRegexStr(name, false, true), true
+	case PATTERN_MONTH, PATTERN_DAY, PATTERN_HOUR, PATTERN_MINUTE, PATTERN_SECOND:
+		return GenPDPRegexStr(name, true, false), true
 	}
+	return "", false
+}
 
-	if (len(tar.URLs) != len(tar.IndexPatterns) && (1 != len(tar.IndexPatterns) && 1 != len(tar.URLs))) ||
-		(len(tar.URLs) != len(tar.ContentPatterns) && (1 != len(tar.ContentPatterns) && 1 != len(tar.URLs))) {
-		log.Printf("error parsing index/content patterns: len(URL) != len(IndexPattern|ContentPattern) || 1 != len(IndexPattern|ContentPattern")
-		return false
+// split pattern into tokens, see PATTERN_TOKEN_* for the token types.
+// Text which is not a token is kept as raw regex.
+func TokenizePattern(pat string) (tokens []PatternToken, err error) {
+	textStart := 0
+	// offsets of the open [[
+	var blockStarts []int
+	addText := func(end int) {
+		if textStart < end {
+			tokens = append(tokens, PatternToken{Type: PATTERN_TOKEN_TEXT, Pos: textStart, Text: pat[textStart:end]})
+		}
 	}
 
-	for _, indexPat := range tar.IndexPatterns {
-		// IndexPattern should contain both {title} and {link}
-		if "" == indexPat {
-			log.Print("[ERROR] index pattern is empty")
-			return false
+	for i := 0; i < len(pat); {
+		var token *PatternToken
+		switch {
+		case '{' == pat[i]:
+			end := strings.IndexByte(pat[i:], '}')
+			if -1 == end {
+				break
+			}
+			raw := pat[i : i+end+1]
+			name := raw[1 : len(raw)-1]
+			if strings.HasPrefix(name, PATTERN_ATTR_PREFIX) {
+				attr := strings.Split(strings.TrimPrefix(name, PATTERN_ATTR_PREFIX), ":")
+				if 2 < len(attr) || !PATTERN_ATTR_NAME_REGEX.MatchString(attr[0]) ||
+					(2 == len(attr) && !CUSTOM_FIELD_NAME_REGEX.MatchString(attr[1])) {
+					return nil, &PatternError{Pos: i, Msg: "invalid attribute pattern " + raw}
+				}
+				token = &PatternToken{Type: PATTERN_TOKEN_ATTR, Name: attr[0]}
+				if 2 == len(attr) {
+					token.Field = attr[1]
+				}
+			} else if CUSTOM_FIELD_NAME_REGEX.MatchString(name) {
+				token = &PatternToken{Type: PATTERN_TOKEN_FIELD, Name: name}
+			}
+			if nil != token {
+				token.Text = raw
+			}
+		case strings.HasPrefix(pat[i:], PATTERN_OPTIONAL_START) && !PATTERN_POSIX_CLASS_REGEX.MatchString(pat[i:]):
+			// [[:alpha:]] is a posix class of regex
+			blockStarts = append(blockStarts, i)
+			token = &PatternToken{Type: PATTERN_TOKEN_OPTIONAL_START, Text: PATTERN_OPTIONAL_START}
+		case 0 < len(blockStarts) && strings.HasPrefix(pat[i:], PATTERN_ALTERNATIVE):
+			token = &PatternToken{Type: PATTERN_TOKEN_ALTERNATIVE, Text: PATTERN_ALTERNATIVE}
+		case 0 < len(blockStarts) && strings.HasPrefix(pat[i:], PATTERN_OPTIONAL_END):
+			// ]] out of blocks is just text, ]]> of CDATA for example
+			blockStarts = blockStarts[:len(blockStarts)-1]
+			token = &PatternToken{Type: PATTERN_TOKEN_OPTIONAL_END, Text: PATTERN_OPTIONAL_END}
 		}
 
-		if 1 != strings.Count(indexPat, GenPDPName(PATTERN_TITLE)) || 1 != strings.Count(indexPat, GenPDPName(PATTERN_LINK)) {
-			log.Printf("[ERROR] index pattern %s should contain 1 %s and 1 %s ", indexPat, GenPDPName(PATTERN_TITLE), GenPDPName(PATTERN_LINK))
-			return false
+		if nil == token {
+			i += 1
+			continue
 		}
+		addText(i)
+		token.Pos = i
+		tokens = append(tokens, *token)
+		i += len(token.Text)
+		textStart = i
 	}
+	addText(len(pat))
 
-	for _, contentPat := range tar.ContentPatterns {
-		// ContentPattern should contain {content} and should not contain {title} nor {link}
-		if "" == contentPat {
-			log.Print("content pattern is empty")
-			return false
-		}
+	if 0 != len(blockStarts) {
+		return nil, &PatternError{Pos: blockStarts[len(blockStarts)-1], Msg: PATTERN_OPTIONAL_START + " is not closed"}
+	}
+	return
+}
 
-		if 1 != strings.Count(contentPat, GenPDPName(PATTERN_CONTENT)) {
-			log.Printf("[ERROR] content pattern %s should contain 1 %s", contentPat, GenPDPName(PATTERN_CONTENT))
-			return false
-		}
+// convert pattern to regex, fields maps custom fields to the pre-defined patterns, see Feed.Fields.
+// [[ a ]] is optional and [[ a || b ]] matches either a or b.
+func PatternToRegex(pat string, fields map[string]string) (string, error) {
+	tokens, err := TokenizePattern(pat)
+	if nil != err {
+		return "", err
+	}
 
-		if strings.Contains(contentPat, GenPDPName(PATTERN_TITLE)) || strings.Contains(contentPat, GenPDPName(PATTERN_LINK)) {
-			log.Printf("[ERROR] %s should not contain %s or %s", contentPat, GenPDPName(PATTERN_TITLE), GenPDPName(PATTERN_LINK))
-			return false
+	var regStr bytes.Buffer
+	// whether the open blocks have alternatives
+	var blocks []bool
+	for ind, token := range tokens {
+		switch token.Type {
+		case PATTERN_TOKEN_TEXT:
+			regStr.WriteString(token.Text)
+		case PATTERN_TOKEN_FIELD:
+			name := token.Name
+			if field, ok := fields[name]; ok {
+				name = field
+			}
+			if fieldReg, ok := PredefinedPatternRegex(name); ok {
+				regStr.WriteString(fieldReg)
+			} else {
+				// not a pattern, {2} for example
+				regStr.WriteString(token.Text)
+			}
+		case PATTERN_TOKEN_ATTR:
+			// any attribute value quoted with " or ', or not quoted
+			regStr.WriteString(`[^>]*?\s` + regexp.QuoteMeta(token.Name) + `\s*=\s*["']?`)
+			if "" == token.Field {
+				regStr.WriteString(`[^"'>]*`)
+			} else {
+				field := token.Field
+				if mapped, ok := fields[field]; ok {
+					field = mapped
+				}
+				regStr.WriteString(`(?P<` + field + `>[^"'>]*)`)
+			}
+			regStr.WriteString(`["']?[^>]*?`)
+		case PATTERN_TOKEN_OPTIONAL_START:
+			blocks = append(blocks, false)
+			regStr.WriteString("(?:")
+		case PATTERN_TOKEN_ALTERNATIVE:
+			blocks[len(blocks)-1] = true
+			regStr.WriteString("|")
+		case PATTERN_TOKEN_OPTIONAL_END:
+			if blocks[len(blocks)-1] {
+				regStr.WriteString(")")
+			} else {
+				regStr.WriteString(")?")
+			}
+			blocks = blocks[:len(blocks)-1]
+		default:
+			return "", fmt.Errorf("unknown token %s at %d", tokens[ind].Text, tokens[ind].Pos)
 		}
 	}
 
-	// check filter patterns
-	if (0 != len(tar.IndexFilterPatterns) && len(tar.IndexFilterPatterns) != len(tar.IndexPatterns)) ||
-		(0 != len(tar.ContentFilterPatterns) && len(tar.ContentFilterPatterns) != len(tar.ContentPatterns)) {
-		log.Printf("error parsing filter patterns: length must be 0 or the same as Feed.IndexPattern/Feed.ContentPattern")
-		return false
+	return regStr.String(), nil
+}
+
+func CompilePattern(pat string, fields map[string]string) (*regexp.Regexp, error) {
+	regStr, err := PatternToRegex(pat, fields)
+	if nil != err {
+		return nil, err
 	}
+	return regexp.Compile(regStr)
+}
 
-	for _, indFilterPat := range tar.IndexFilterPatterns {
-		if "" == indFilterPat {
-			continue
-		}
-		if 1 > strings.Count(indFilterPat, GenPDPName(PATTERN_FILTER)) {
-			log.Printf("[ERROR] index filter pattern %s should be empty or contain more than one %s", indFilterPat, GenPDPName(PATTERN_FILTER))
-			return false
+// count the placeholders of field in pattern, including {attr:name:field}, return -1 if pattern is invalid
+func CountPatternField(pat, field string) (count int) {
+	tokens, err := TokenizePattern(pat)
+	if nil != err {
+		return -1
+	}
+	for _, token := range tokens {
+		if (PATTERN_TOKEN_FIELD == token.Type && field == token.Name) || (PATTERN_TOKEN_ATTR == token.Type && field == token.Field) {
+			count += 1
 		}
 	}
+	return
+}
 
-	for _, contFilterPat := range tar.ContentFilterPatterns {
-		if "" == contFilterPat {
-			continue
+// all the non-empty patterns of target
+func GetTargetPatterns(tar *TargetConfig) (pats []string) {
+	for _, patList := range [][]string{tar.IndexPatterns, tar.ContentPatterns, tar.IndexFilterPatterns, tar.ContentFilterPatterns,
+		tar.PubDatePatterns, []string{tar.NextPagePattern, tar.ContentNextPagePattern}} {
+		for _, pat := range patList {
+			if "" != pat {
+				pats = append(pats, pat)
+			}
 		}
-		if 1 > strings.Count(contFilterPat, GenPDPName(PATTERN_FILTER)) {
-			log.Printf("[ERROR] content filter pattern %s should be empty or contain more than one %s", contFilterPat, GenPDPName(PATTERN_FILTER))
-			return false
+	}
+	for _, nav := range tar.Navigation {
+		pats = append(pats, nav.Pattern)
+		if "" != nav.FilterPattern {
+			pats = append(pats, nav.FilterPattern)
 		}
 	}
+	return
+}
 
-	//@TODO check pubdate pattern
+// see LintCustomFields
+func CheckCustomFields(fields map[string]string) bool {
+	return LogPatternIssues(LintCustomFields(fields))
+}
 
-	return true
+// print the issues found by LintPatterns, return false if there is any error
+func CheckPatterns(tar *TargetConfig) bool {
+	if nil == tar {
+		log.Printf("[ERROR] invliad target, nil")
+		return false
+	}
+	return LogPatternIssues(LintPatterns(tar))
 }
 
 func CompilePatterns(feedTar *FeedTarget, tar *TargetConfig) (err error) {
@@ -114,7 +223,7 @@ func CompilePatterns(feedTar *FeedTarget, tar *TargetConfig) (err error) {
 
 	// index pattern
 	for j := 0; j < len(tar.IndexPatterns); j++ {
-		feedTar.IndexRegs[j], err = regexp.Compile(PatternToRegex(tar.IndexPatterns[j]))
+		feedTar.IndexRegs[j], err = CompilePattern(tar.IndexPatterns[j], tar.Fields)
 		if nil != err {
 			log.Printf("[ERROR] error compiling index pattern %s", tar.IndexPatterns[j])
 			return
@@ -123,7 +232,7 @@ func CompilePatterns(feedTar *FeedTarget, tar *TargetConfig) (err error) {
 
 	// content pattern
 	for j := 0; j < len(tar.ContentPatterns); j++ {
-		feedTar.ContentRegs[j], err = regexp.Compile(PatternToRegex(tar.ContentPatterns[j]))
+		feedTar.ContentRegs[j], err = CompilePattern(tar.ContentPatterns[j], tar.Fields)
 		if nil != err {
 			log.Printf("[ERROR] error compiling content pattern %s", tar.ContentPatterns[j])
 			return
@@ -135,7 +244,7 @@ func CompilePatterns(feedTar *FeedTarget, tar *TargetConfig) (err error) {
 		if "" == strings.TrimSpace(tar.IndexPatterns[j]) {
 			continue
 		}
-		feedTar.IndexFilterRegs[j], err = regexp.Compile(PatternToRegex(tar.IndexFilterPatterns[j]))
+		feedTar.IndexFilterRegs[j], err = CompilePattern(tar.IndexFilterPatterns[j], nil)
 		if nil != err {
 			log.Printf("[ERROR] error compiling index filter pattern %s", tar.IndexFilterPatterns[j])
 			return
@@ -147,7 +256,7 @@ func CompilePatterns(feedTar *FeedTarget, tar *TargetConfig) (err error) {
 		if "" == strings.TrimSpace(tar.ContentPatterns[j]) {
 			continue
 		}
-		feedTar.ContentFilterRegs[j], err = regexp.Compile(PatternToRegex(tar.ContentFilterPatterns[j]))
+		feedTar.ContentFilterRegs[j], err = CompilePattern(tar.ContentFilterPatterns[j], nil)
 		if nil != err {
 			log.Printf("[ERROR] error compiling content filter pattern %s", tar.ContentFilterPatterns[j])
 			return
@@ -159,13 +268,80 @@ func CompilePatterns(feedTar *FeedTarget, tar *TargetConfig) (err error) {
 		if "" == strings.TrimSpace(tar.PubDatePatterns[j]) {
 			continue
 		}
-		feedTar.PubDateRegs[j], err = regexp.Compile(PatternToRegex(tar.PubDatePatterns[j]))
+		feedTar.PubDateRegs[j], err = CompilePattern(tar.PubDatePatterns[j], nil)
 		if nil != err {
 			log.Printf("[ERROR] error compiling publish date pattern %s", tar.PubDatePatterns[j])
 			return
 		}
 	}
 
+	// next page patterns
+	if "" != strings.TrimSpace(tar.NextPagePattern) {
+		feedTar.NextPageReg, err = CompilePattern(tar.NextPagePattern, nil)
+		if nil != err {
+			log.Printf("[ERROR] error compiling next page pattern %s", tar.NextPagePattern)
+			return
+		}
+	}
+
+	if "" != strings.TrimSpace(tar.ContentNextPagePattern) {
+		feedTar.ContentNextPageReg, err = CompilePattern(tar.ContentNextPagePattern, nil)
+		if nil != err {
+			log.Printf("[ERROR] error compiling content next page pattern %s", tar.ContentNextPagePattern)
+			return
+		}
+	}
+
+	// navigation patterns
+	feedTar.Navigation = make([]*NavigationStep, len(tar.Navigation))
+	for j, nav := range tar.Navigation {
+		step := new(NavigationStep)
+		step.Reg, err = CompilePattern(nav.Pattern, tar.Fields)
+		if nil != err {
+			log.Printf("[ERROR] error compiling navigation pattern %s", nav.Pattern)
+			return
+		}
+		if "" != strings.TrimSpace(nav.FilterPattern) {
+			step.FilterReg, err = CompilePattern(nav.FilterPattern, nil)
+			if nil != err {
+				log.Printf("[ERROR] error compiling navigation filter pattern %s", nav.FilterPattern)
+				return
+			}
+		}
+		feedTar.Navigation[j] = step
+	}
+
+	// xpath rules
+	feedTar.IndexXPath, err = CompileXPathRule(tar.IndexXPath)
+	if nil != err {
+		log.Printf("[ERROR] error compiling Feed.IndexXPath")
+		return
+	}
+	feedTar.ContentXPath, err = CompileXPathRule(tar.ContentXPath)
+	if nil != err {
+		log.Printf("[ERROR] error compiling Feed.ContentXPath")
+		return
+	}
+
+	// css selector rules
+	feedTar.IndexSelector, err = CompileSelectorRule(tar.IndexSelector)
+	if nil != err {
+		log.Printf("[ERROR] error compiling Feed.IndexSelector")
+		return
+	}
+	feedTar.ContentSelector, err = CompileSelectorRule(tar.ContentSelector)
+	if nil != err {
+		log.Printf("[ERROR] error compiling Feed.ContentSelector")
+		return
+	}
+
+	// json path rules
+	feedTar.IndexJsonPath, err = CompileJsonPathRule(tar.IndexJsonPath)
+	if nil != err {
+		log.Printf("[ERROR] error compiling Feed.IndexJsonPath")
+		return
+	}
+
 	return
 }
 
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+	"math"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// extract the main content of the page without rules, like the readability of arc90.
+// Paragraphs are scored by their text, and the scores are added to their parents and
+// grandparents. The node with the highest score after the link density penalty is the content.
+type ReadabilityExtractor struct {
+	feedTar *FeedTarget
+}
+
+func NewReadabilityExtractor(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error) {
+	return &ReadabilityExtractor{feedTar: feedTar}, nil
+}
+
+func (ext *ReadabilityExtractor) ExtractIndex(feed *Feed, indexURL *url.URL, htmlData []byte) ([]*FeedEntry, error) {
+	return nil, errors.New("readability extractor can only be used for content pages")
+}
+
+func (ext *ReadabilityExtractor) ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (fields EntryFields, err error) {
+	doc, err := ParseHtmlDom(htmlData)
+	if nil != err {
+		return
+	}
+	top := FindReadableNode(doc)
+	if nil == top {
+		return nil, errors.New("no readable content found")
+	}
+	return EntryFields{PATTERN_CONTENT: []byte(htmlquery.OutputHTML(top, false))}, nil
+}
+
+// find the node of the main content in doc, nil if not found or its score is lower than READABILITY_MIN_SCORE.
+// Unlikely nodes are removed from doc.
+func FindReadableNode(doc *html.Node) (top *html.Node) {
+	RemoveUnlikelyNodes(doc)
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	addScore := func(node *html.Node, score float64) {
+		if nil == node || html.ElementNode != node.Type {
+			return
+		}
+		if _, ok := scores[node]; !ok {
+			scores[node] = InitialNodeScore(node)
+			candidates = append(candidates, node)
+		}
+		scores[node] += score
+	}
+
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if html.ElementNode == node.Type && IsParagraphNode(node) {
+			text := strings.TrimSpace(htmlquery.InnerText(node))
+			if utf8.RuneCountInString(text) >= READABILITY_MIN_TEXT_LEN {
+				// one point for the paragraph, one for each comma and up to 3 for its length
+				score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")) +
+					math.Min(float64(utf8.RuneCountInString(text)/100), 3)
+				addScore(node.Parent, score)
+				if nil != node.Parent {
+					addScore(node.Parent.Parent, score/2)
+				}
+			}
+		}
+		for child := node.FirstChild; nil != child; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	topScore := 0.0
+	for _, node := range candidates {
+		score := scores[node] * (1 - LinkDensity(node))
+		if nil == top || score > topScore {
+			top, topScore = node, score
+		}
+	}
+	if READABILITY_MIN_SCORE > topScore {
+		return nil
+	}
+	return
+}
+
+// remove the tags in READABILITY_REMOVED_TAGS and the nodes whose class or id looks like junk
+func RemoveUnlikelyNodes(node *html.Node) {
+	for child := node.FirstChild; nil != child; {
+		next := child.NextSibling
+		if html.ElementNode == child.Type {
+			classID := NodeAttr(child, "class") + " " + NodeAttr(child, "id")
+			if StringInSlice(child.Data, READABILITY_REMOVED_TAGS) ||
+				(READABILITY_UNLIKELY_REGEX.MatchString(classID) && !READABILITY_POSITIVE_REGEX.MatchString(classID) &&
+					"body" != child.Data && "html" != child.Data) {
+				node.RemoveChild(child)
+			} else {
+				RemoveUnlikelyNodes(child)
+			}
+		}
+		child = next
+	}
+}
+
+// paragraphs are p, pre, blockquote and td, or div without block children
+func IsParagraphNode(node *html.Node) bool {
+	switch node.Data {
+	case "p", "pre", "blockquote", "td":
+		return true
+	case "div":
+		for child := node.FirstChild; nil != child; child = child.NextSibling {
+			if html.ElementNode == child.Type && StringInSlice(child.Data, []string{"div", "p", "pre", "blockquote", "table", "ul", "ol", "section", "article"}) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// score of the tag name, and class and id names of node
+func InitialNodeScore(node *html.Node) (score float64) {
+	switch node.Data {
+	case "article":
+		score = 10
+	case "div", "section", "main":
+		score = 5
+	case "pre", "td", "blockquote":
+		score = 3
+	case "ul", "ol", "dl", "form":
+		score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score = -5
+	}
+	for _, name := range []string{NodeAttr(node, "class"), NodeAttr(node, "id")} {
+		if READABILITY_NEGATIVE_REGEX.MatchString(name) {
+			score -= READABILITY_CLASS_WEIGHT
+		}
+		if READABILITY_POSITIVE_REGEX.MatchString(name) {
+			score += READABILITY_CLASS_WEIGHT
+		}
+	}
+	return
+}
+
+// ratio of the text in links to all the text of node
+func LinkDensity(node *html.Node) float64 {
+	textLen := utf8.RuneCountInString(strings.TrimSpace(htmlquery.InnerText(node)))
+	if 0 == textLen {
+		return 0
+	}
+	linkLen := 0
+	for _, link := range htmlquery.Find(node, ".//a") {
+		linkLen += utf8.RuneCountInString(strings.TrimSpace(htmlquery.InnerText(link)))
+	}
+	return float64(linkLen) / float64(textLen)
+}
+
+func NodeAttr(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if name == attr.Key {
+			return attr.Val
+		}
+	}
+	return ""
+}
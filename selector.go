@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+	"log"
+	"net/url"
+	"strings"
+)
+
+func CompileCssSelector(sel string) (cssSel *CssSelector, err error) {
+	sel = strings.TrimSpace(sel)
+	if "" == sel {
+		return
+	}
+
+	cssSel = &CssSelector{Raw: sel}
+	if match := CSS_SELECTOR_ATTR_REGEX.FindStringSubmatch(sel); nil != match {
+		sel = strings.TrimSpace(match[1])
+		cssSel.Attr = match[2]
+	}
+	if "" != sel {
+		cssSel.Selector, err = cascadia.Compile(sel)
+	}
+
+	return
+}
+
+func CompileSelectorRule(ruleConf *ExtractRuleConfig) (rule *SelectorRule, err error) {
+	if nil == ruleConf {
+		return
+	}
+
+	rule = new(SelectorRule)
+	sels := []struct {
+		sel     string
+		compSel **CssSelector
+	}{
+		{ruleConf.Entry, &rule.Entry},
+		{ruleConf.Title, &rule.Title},
+		{ruleConf.Link, &rule.Link},
+		{ruleConf.Description, &rule.Description},
+		{ruleConf.PubDate, &rule.PubDate},
+	}
+	for _, s := range sels {
+		*s.compSel, err = CompileCssSelector(s.sel)
+		if nil != err {
+			log.Printf("[ERROR] error compiling css selector %s: %s", s.sel, err)
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// select the first matched node of top(including top itself), return attribute value if
+// Attr is defined, otherwise description is the inner html and other fields are inner text
+func CssSelectField(top *html.Node, sel *CssSelector, fieldName string) (value []byte, err error) {
+	node := top
+	if nil != sel.Selector {
+		node = sel.Selector.MatchFirst(top)
+	}
+	if nil == node {
+		return nil, errors.New("css selector " + sel.Raw + " selected nothing")
+	}
+
+	if "" != sel.Attr {
+		if !htmlquery.ExistsAttr(node, sel.Attr) {
+			return nil, errors.New("attribute " + sel.Attr + " not found, css selector is " + sel.Raw)
+		}
+		return []byte(strings.TrimSpace(htmlquery.SelectAttr(node, sel.Attr))), nil
+	}
+	if PATTERN_CONTENT == fieldName {
+		return []byte(htmlquery.OutputHTML(node, false)), nil
+	}
+	return []byte(strings.TrimSpace(htmlquery.InnerText(node))), nil
+}
+
+// extract entries with Feed.IndexSelector and Feed.ContentSelector
+type SelectorExtractor struct {
+	feedTar *FeedTarget
+}
+
+func NewSelectorExtractor(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error) {
+	return &SelectorExtractor{feedTar: feedTar}, nil
+}
+
+func (ext *SelectorExtractor) ExtractIndex(feed *Feed, tarURL *url.URL, htmlData []byte) (entries []*FeedEntry, err error) {
+	feedTar := ext.feedTar
+	rule := feedTar.IndexSelector
+	if nil == rule {
+		return nil, errors.New("Feed.IndexSelector not defined")
+	}
+	doc, err := ParseHtmlDom(htmlData)
+	if nil != err {
+		return
+	}
+
+	var entryNodes []*html.Node
+	if nil != rule.Entry.Selector {
+		entryNodes = rule.Entry.Selector.MatchAll(doc)
+	}
+	if 0 == len(entryNodes) {
+		return nil, errors.New("css selector " + rule.Entry.Raw + " selected nothing")
+	}
+
+	fields := []struct {
+		sel  *CssSelector
+		name string
+	}{
+		{rule.Title, PATTERN_TITLE},
+		{rule.Link, PATTERN_LINK},
+		{rule.Description, PATTERN_CONTENT},
+		{rule.PubDate, PATTERN_PUBDATE},
+	}
+	for _, entryNode := range entryNodes {
+		entry := new(FeedEntry)
+		for _, field := range fields {
+			if nil == field.sel {
+				continue
+			}
+			value, err := CssSelectField(entryNode, field.sel, field.name)
+			if nil != err {
+				log.Printf("[WARN] failed to extract %s from index html %s: %s", field.name, tarURL.String(), err)
+				continue
+			}
+			SetEntryField(feedTar, feed, entry, tarURL, field.name, value)
+		}
+		entries = append(entries, entry)
+	}
+
+	return
+}
+
+func (ext *SelectorExtractor) ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (fields EntryFields, err error) {
+	rule := ext.feedTar.ContentSelector
+	if nil == rule {
+		return nil, errors.New("Feed.ContentSelector not defined")
+	}
+	doc, err := ParseHtmlDom(htmlData)
+	if nil != err {
+		return
+	}
+
+	value, err := CssSelectField(doc, rule.Description, PATTERN_CONTENT)
+	if nil != err {
+		return
+	}
+	fields = EntryFields{PATTERN_CONTENT: value}
+
+	if nil != rule.PubDate {
+		value, err = CssSelectField(doc, rule.PubDate, PATTERN_PUBDATE)
+		if nil != err {
+			log.Printf("[WARN] failed to extract pubdate from content html %s: %s", entry.Link, err)
+		} else {
+			fields[PATTERN_PUBDATE] = value
+		}
+	}
+
+	return fields, nil
+}
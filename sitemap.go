@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"golang.org/x/net/html/charset"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// extract entry links from sitemap or sitemap index, used for the index pages in Feed.Mode "sitemap"
+type SitemapExtractor struct {
+	feedTar    *FeedTarget
+	maxEntries int
+	linkReg    *regexp.Regexp
+}
+
+func NewSitemapExtractor(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error) {
+	options := SitemapOptions{MaxEntries: SITEMAP_MAX_ENTRIES}
+	if 0 != len(tar.ExtractorOptions) {
+		if err := json.Unmarshal(tar.ExtractorOptions, &options); nil != err {
+			return nil, errors.New("invalid Feed.ExtractorOptions: " + err.Error())
+		}
+	}
+
+	ext := &SitemapExtractor{feedTar: feedTar, maxEntries: options.MaxEntries}
+	if 0 >= ext.maxEntries {
+		ext.maxEntries = SITEMAP_MAX_ENTRIES
+	}
+	if "" != options.LinkPattern {
+		linkReg, err := regexp.Compile(options.LinkPattern)
+		if nil != err {
+			return nil, err
+		}
+		ext.linkReg = linkReg
+	}
+
+	return ext, nil
+}
+
+func ParseSitemap(sitemapData []byte) (sitemap *SourceSitemap, err error) {
+	sitemapData, err = GunzipData(sitemapData)
+	if nil != err {
+		return
+	}
+
+	sitemap = new(SourceSitemap)
+	decoder := xml.NewDecoder(bytes.NewReader(sitemapData))
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	if err = decoder.Decode(sitemap); nil != err {
+		return nil, err
+	}
+
+	switch sitemap.XMLName.Local {
+	case "urlset", "sitemapindex":
+	default:
+		return nil, errors.New("unknown sitemap type " + sitemap.XMLName.Local)
+	}
+
+	return
+}
+
+// sort sitemap urls by lastmod, latest first, urls without lastmod are put at the end
+func SortSitemapURLs(sitemapURLs []SitemapURL) {
+	lastMods := make(map[string]time.Time)
+	for _, sitemapURL := range sitemapURLs {
+		if lastMod, err := ParseStandardTime(FirstNonEmpty(sitemapURL.NewsPubDate, sitemapURL.LastMod)); nil == err {
+			lastMods[sitemapURL.Loc] = lastMod
+		}
+	}
+	sort.SliceStable(sitemapURLs, func(i, j int) bool {
+		return lastMods[sitemapURLs[i].Loc].After(lastMods[sitemapURLs[j].Loc])
+	})
+}
+
+// sitemaps are xml, which are not minified
+func (ext *SitemapExtractor) RawData() bool {
+	return true
+}
+
+func (ext *SitemapExtractor) ExtractIndex(feed *Feed, indexURL *url.URL, htmlData []byte) (entries []*FeedEntry, err error) {
+	sitemap, err := ParseSitemap(htmlData)
+	if nil != err {
+		return
+	}
+
+	sitemapURLs := ext.filterURLs(sitemap.Urls)
+	// read sitemaps of the sitemap index, latest first, until there are enough urls
+	SortSitemapURLs(sitemap.Sitemaps)
+	for _, child := range sitemap.Sitemaps {
+		if len(sitemapURLs) >= ext.maxEntries {
+			break
+		}
+		childURL, err := indexURL.Parse(strings.TrimSpace(child.Loc))
+		if nil != err {
+			log.Printf("[ERROR] invalid sitemap url %s: %s", child.Loc, err)
+			continue
+		}
+		time.Sleep(ext.feedTar.ReqInterval * time.Second)
+		cache, err := FetchHtml(childURL, ext.feedTar)
+		if nil == cache || nil != err {
+			log.Printf("[ERROR] failed to download sitemap %s", childURL.String())
+			continue
+		}
+		childSitemap, err := ParseSitemap(cache.Html)
+		if nil != err {
+			log.Printf("[ERROR] failed to parse sitemap %s: %s", childURL.String(), err)
+			continue
+		}
+		// nested sitemap index is not allowed by the protocol, just ignore it
+		sitemapURLs = append(sitemapURLs, ext.filterURLs(childSitemap.Urls)...)
+	}
+
+	SortSitemapURLs(sitemapURLs)
+	if len(sitemapURLs) > ext.maxEntries {
+		sitemapURLs = sitemapURLs[:ext.maxEntries]
+	}
+
+	for _, sitemapURL := range sitemapURLs {
+		entry := new(FeedEntry)
+		SetEntryField(ext.feedTar, feed, entry, indexURL, PATTERN_LINK, []byte(strings.TrimSpace(sitemapURL.Loc)))
+		// title is extracted from the content page if not defined
+		SetEntryField(ext.feedTar, feed, entry, indexURL, PATTERN_TITLE, []byte(strings.TrimSpace(sitemapURL.NewsTitle)))
+		if pubDate := FirstNonEmpty(sitemapURL.NewsPubDate, sitemapURL.LastMod); "" != pubDate {
+			SetEntryField(ext.feedTar, feed, entry, indexURL, PATTERN_PUBDATE, []byte(pubDate))
+		}
+		entries = append(entries, entry)
+	}
+
+	if 0 == len(entries) {
+		err = errors.New("no url found in sitemap")
+	}
+	return
+}
+
+// remove urls not matched by LinkPattern
+func (ext *SitemapExtractor) filterURLs(sitemapURLs []SitemapURL) (result []SitemapURL) {
+	for _, sitemapURL := range sitemapURLs {
+		if "" == strings.TrimSpace(sitemapURL.Loc) {
+			continue
+		}
+		if nil == ext.linkReg || ext.linkReg.MatchString(sitemapURL.Loc) {
+			result = append(result, sitemapURL)
+		}
+	}
+	return
+}
+
+func (ext *SitemapExtractor) ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (EntryFields, error) {
+	return nil, errors.New("sitemap extractor can only be used for index pages")
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// gofeed test, run the patterns of a target in json config, or the patterns defined
+// in the command line, against the pages and print the extracted entries
+func RunTestCommand(args []string) (ok bool) {
+	cmd := flag.NewFlagSet(CMD_TEST, flag.ExitOnError)
+	targetName := cmd.String("t", "", "Feed.Title or Feed.Path of the target in json_config_file, default is the first target")
+	pageURL := cmd.String("url", "", "url of the index page, replaces Feed.URL")
+	indexFile := cmd.String("file", "", "read the index page from a local html file instead of downloading it")
+	contentFile := cmd.String("content-file", "", "read the content page of the first entry from a local html file")
+	indexPat := cmd.String("index", "", "replaces Feed.IndexPattern")
+	indexFilterPat := cmd.String("index-filter", "", "replaces Feed.IndexFilterPattern")
+	contentPat := cmd.String("content", "", "replaces Feed.ContentPattern")
+	contentFilterPat := cmd.String("content-filter", "", "replaces Feed.ContentFilterPattern")
+	pubDatePat := cmd.String("pubdate", "", "replaces Feed.PubDatePattern")
+	cacheDB := cmd.String("cache", "", "path of the cache database, default is CacheDB of json_config_file or "+DB_NAME)
+	maxEntries := cmd.Int("n", TEST_MAX_ENTRIES, "number of entries whose content pages are tested")
+	cmd.Usage = func() {
+		fmt.Printf("Usage %s test [-t target][-url url][-file html_file][-index pattern][-content pattern][-n entry_number] [json_config_file]\n\n", os.Args[0])
+		fmt.Printf("Flags:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if 1 < cmd.NArg() || (0 == cmd.NArg() && "" == *pageURL) {
+		cmd.Usage()
+		return false
+	}
+
+	conf := &Config{Targets: []TargetConfig{TargetConfig{}}}
+	if 1 == cmd.NArg() {
+		var err error
+		if conf, err = LoadJsonConfig(cmd.Arg(0)); nil != err {
+			log.Printf("[ERROR] %s: %s", cmd.Arg(0), err)
+			return false
+		}
+	}
+	tar := FindTargetConfig(conf, *targetName)
+	if nil == tar {
+		log.Printf("[ERROR] feed target %s not found in %s", *targetName, cmd.Arg(0))
+		return false
+	}
+
+	// command line options replace the ones of the target
+	for _, opt := range []struct {
+		value string
+		pats  *[]string
+	}{
+		{*pageURL, &tar.URLs},
+		{*indexPat, &tar.IndexPatterns},
+		{*indexFilterPat, &tar.IndexFilterPatterns},
+		{*contentPat, &tar.ContentPatterns},
+		{*contentFilterPat, &tar.ContentFilterPatterns},
+		{*pubDatePat, &tar.PubDatePatterns},
+	} {
+		if "" != opt.value {
+			*opt.pats = []string{opt.value}
+		}
+	}
+	if "" != *cacheDB {
+		conf.CacheDB = *cacheDB
+	}
+	if err := CheckConfig(conf); nil != err {
+		log.Printf("[ERROR] %s", err)
+		return false
+	}
+
+	feedTar, err := BuildFeedTarget(conf, tar)
+	if nil != err {
+		log.Printf("[ERROR] failed to parse feed target %s: %s", TargetName(tar), err)
+		return false
+	}
+	if err = InitCacheDB(feedTar.CacheDB, feedTar.CacheLifetime); nil != err {
+		log.Printf("[ERROR] failed to create cache database %s", feedTar.CacheDB)
+		return false
+	}
+
+	feed, steps := RunTargetTest(feedTar, *indexFile, *contentFile, *maxEntries, true)
+	PrintTestResult(os.Stdout, feed, steps)
+
+	if 0 == len(feed.Entries) {
+		return false
+	}
+	for _, step := range steps {
+		if step.Failed {
+			return false
+		}
+	}
+	return true
+}
+
+// find target by Feed.Title or output path, the first target is returned if name is empty
+func FindTargetConfig(conf *Config, name string) *TargetConfig {
+	for ind := range conf.Targets {
+		tar := &conf.Targets[ind]
+		if "" == name || name == tar.Title || name == tar.FeedPath {
+			return tar
+		}
+		for _, output := range tar.Outputs {
+			if name == output.Path {
+				return tar
+			}
+		}
+	}
+	return nil
+}
+
+// read page from file if file is not empty, otherwise download it. The page is minified
+// and scripts are removed, as the extractors see it.
+func LoadTestPage(feedTar *FeedTarget, pageURL *url.URL, file string) (htmlData []byte, err error) {
+	if htmlData, err = ReadTestPage(feedTar, pageURL, file); nil != err {
+		return
+	}
+	return MinifyHtml(RemoveJunkContent(htmlData)), nil
+}
+
+// read page from file if file is not empty, otherwise download it
+func ReadTestPage(feedTar *FeedTarget, pageURL *url.URL, file string) (htmlData []byte, err error) {
+	if "" != file {
+		htmlData, err = ioutil.ReadFile(file)
+	} else {
+		cache, fetchErr := FetchHtml(pageURL, feedTar)
+		if nil == cache || nil != fetchErr {
+			return nil, errors.New("failed to download " + pageURL.String())
+		}
+		htmlData = cache.Html
+	}
+	if nil != err {
+		return
+	}
+
+	return GunzipData(htmlData)
+}
+
+// config key of reg, such as Feed.IndexPattern[1]
+func RegexKey(key string, regs []*regexp.Regexp, reg *regexp.Regexp) string {
+	for ind, r := range regs {
+		if r == reg {
+			return PatternKey(key, ind)
+		}
+	}
+	return key
+}
+
+// filter htmlData with filterReg if it is not nil, then match it with reg.
+// Trace reports are written for the failed steps if trace is true.
+func TestPattern(step, key, filterKey, page string, reg, filterReg *regexp.Regexp, htmlData []byte, trace bool) (steps []TestStep, ok bool) {
+	failedStep := func(step, key string, reg, filterReg *regexp.Regexp, filtered []byte) TestStep {
+		testStep := TestStep{Step: step, Key: key, Page: page, Result: "did not match", Failed: true}
+		if !trace {
+			return testStep
+		}
+		path, err := WriteTraceReport(page, reg, filterReg, htmlData, filtered)
+		if nil != err {
+			log.Printf("[ERROR] failed to write trace report of %s: %s", page, err)
+		}
+		testStep.Trace = path
+		return testStep
+	}
+
+	filtered := htmlData
+	if nil != filterReg {
+		if filtered = RegexpFilter(filterReg, htmlData); nil == filtered {
+			return append(steps, failedStep("filter", filterKey, filterReg, nil, nil)), false
+		}
+		steps = append(steps, TestStep{Step: "filter", Key: filterKey, Page: page, Result: fmt.Sprintf("%d bytes left", len(filtered))})
+	}
+
+	matchNum := len(reg.FindAllIndex(filtered, -1))
+	if 0 == matchNum {
+		return append(steps, failedStep(step, key, reg, filterReg, filtered)), false
+	}
+	return append(steps, TestStep{Step: step, Key: key, Page: page, Result: fmt.Sprintf("%d matches", matchNum)}), true
+}
+
+// run the index, navigation and content steps of feedTar, index pages are read from indexFile and
+// the first content page is read from contentFile if they are not empty.
+// Content pages of the first maxEntries entries are tested, trace reports of the failed patterns
+// are written if trace is true.
+func RunTargetTest(feedTar *FeedTarget, indexFile, contentFile string, maxEntries int, trace bool) (feed *Feed, steps []TestStep) {
+	feed = &Feed{Title: feedTar.Title, Description: feedTar.Description}
+	addStep := func(step, key, page string, failed bool, format string, args ...interface{}) {
+		steps = append(steps, TestStep{Step: step, Key: key, Page: page, Result: fmt.Sprintf(format, args...), Failed: failed})
+	}
+
+	for _, tarURL := range feedTar.URLs {
+		page := tarURL.String()
+		if nil == feed.URL {
+			feed.URL = tarURL
+		}
+		rawData, err := ReadTestPage(feedTar, tarURL, indexFile)
+		if nil != err {
+			addStep("download", "Feed.URL", page, true, "%s", err)
+			continue
+		}
+		htmlData := MinifyHtml(RemoveJunkContent(rawData))
+
+		if EXTRACTOR_PATTERN == feedTar.IndexMode {
+			for _, indexReg := range FindIndexRegs(feedTar, tarURL) {
+				indexSteps, _ := TestPattern("index", RegexKey("Feed.IndexPattern", feedTar.IndexRegs, indexReg),
+					RegexKey("Feed.IndexFilterPattern", feedTar.IndexFilterRegs, FindIndexFilterReg(feedTar, indexReg)),
+					page, indexReg, FindIndexFilterReg(feedTar, indexReg), htmlData, trace)
+				steps = append(steps, indexSteps...)
+			}
+		}
+		entries, err := feedTar.IndexExtractor.ExtractIndex(feed, tarURL, IndexExtractorData(feedTar, rawData, htmlData))
+		if EXTRACTOR_PATTERN != feedTar.IndexMode {
+			// pattern errors have been reported above
+			if nil != err {
+				addStep("index", "Feed.Mode "+feedTar.IndexMode, page, true, "%s", err)
+			} else {
+				addStep("index", "Feed.Mode "+feedTar.IndexMode, page, false, "%d entries", len(entries))
+			}
+		}
+		feed.Entries = append(feed.Entries, entries...)
+
+		if nil != feedTar.NextPageReg {
+			if nextURL := FindNextPageURL(feedTar.NextPageReg, tarURL, htmlData); nil != nextURL {
+				addStep("next page", "Feed.NextPagePattern", page, false, "%s", nextURL.String())
+			} else {
+				addStep("next page", "Feed.NextPagePattern", page, true, "did not match")
+			}
+		}
+	}
+
+	if 0 != len(feedTar.Navigation) && 0 != len(feed.Entries) {
+		pageNum := len(feed.Entries)
+		ParseNavigation(feedTar, feed)
+		addStep("navigation", "Feed.Navigation", feed.URL.String(), 0 == len(feed.Entries), "%d pages, %d entries", pageNum, len(feed.Entries))
+	}
+	RemoveDuplicatEntries(feed)
+
+	for entryInd, entry := range feed.Entries {
+		if entryInd >= maxEntries {
+			break
+		}
+		if nil == entry.Link {
+			continue
+		}
+		page := entry.Link.String()
+		file := ""
+		if 0 == entryInd {
+			file = contentFile
+		}
+		rawData, err := ReadTestPage(feedTar, entry.Link, file)
+		if nil != err {
+			addStep("download", "{link}", page, true, "%s", err)
+			continue
+		}
+		htmlData := MinifyHtml(RemoveJunkContent(rawData))
+		if feedTar.Metadata {
+			filled := ApplyMetadata(entry, rawData)
+			addStep("metadata", "Feed.Metadata", page, false, "%d fields filled %s", len(filled), strings.Join(filled, ", "))
+		}
+		if "" == entry.Title {
+			entry.Title = strings.TrimSpace(html.UnescapeString(ExtractHtmlTitle(htmlData)))
+		}
+
+		// the fallback extractor is tried if content pattern is not defined or failed
+		usedFallback := false
+		if EXTRACTOR_PATTERN == feedTar.ContentMode {
+			contentReg := FindContentReg(feedTar, feed.URL, entry.IndexPattern)
+			if nil == contentReg {
+				// content patterns are optional in the command line
+				addStep("content", "Feed.ContentPattern", page, false, "not defined, skipped")
+				usedFallback = true
+			} else {
+				contentSteps, ok := TestPattern("content", RegexKey("Feed.ContentPattern", feedTar.ContentRegs, contentReg),
+					RegexKey("Feed.ContentFilterPattern", feedTar.ContentFilterRegs, FindContentFilterReg(feedTar, contentReg)),
+					page, contentReg, FindContentFilterReg(feedTar, contentReg), htmlData, trace)
+				steps = append(steps, contentSteps...)
+				usedFallback = !ok
+			}
+			if usedFallback && nil == feedTar.FallbackExtractor {
+				continue
+			}
+		}
+
+		fields, err := ExtractContentWithFallback(feedTar, feed, entry, htmlData)
+		if nil != err {
+			addStep("content", "Feed.ContentMode "+feedTar.ContentMode, page, true, "%s", err)
+			continue
+		}
+		for fieldName, value := range fields {
+			SetEntryField(feedTar, feed, entry, entry.Link, fieldName, value)
+		}
+		ParseContentNextPages(feedTar, feed, entry, htmlData)
+		if usedFallback {
+			addStep("content", "Feed.ContentFallback "+feedTar.FallbackMode, page, false, "%d bytes", len(entry.Content))
+		} else if EXTRACTOR_PATTERN != feedTar.ContentMode {
+			addStep("content", "Feed.ContentMode "+feedTar.ContentMode, page, false, "%d bytes", len(entry.Content))
+		}
+	}
+
+	return
+}
+
+// print steps and the extracted entries as tables
+func PrintTestResult(w io.Writer, feed *Feed, steps []TestStep) {
+	PrintTestSteps(w, steps)
+
+	fmt.Fprintf(w, "\n%d entries\n", len(feed.Entries))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tTITLE\tLINK\tPUBDATE\tDESCRIPTION")
+	for ind, entry := range feed.Entries {
+		link, pubDate, content := "-", "-", "-"
+		if nil != entry.Link {
+			link = TruncateString(entry.Link.String(), TEST_COLUMN_WIDTH)
+		}
+		if nil != entry.PubDate {
+			pubDate = entry.PubDate.Format("2006-01-02 15:04:05")
+		}
+		if 0 != len(entry.Content) {
+			content = fmt.Sprintf("%d bytes", len(entry.Content))
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", ind+1, TruncateString(entry.Title, TEST_COLUMN_WIDTH), link, pubDate, content)
+	}
+	tw.Flush()
+}
+
+// print steps as a table, followed by the paths of their trace reports
+func PrintTestSteps(w io.Writer, steps []TestStep) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tKEY\tPAGE\tRESULT")
+	for _, step := range steps {
+		result := step.Result
+		if step.Failed {
+			result = "FAILED: " + result
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", step.Step, step.Key, TruncateString(step.Page, TEST_COLUMN_WIDTH), result)
+	}
+	tw.Flush()
+	for _, step := range steps {
+		if "" != step.Trace {
+			fmt.Fprintf(w, "trace report of %s %s on %s: %s\n", step.Step, step.Key, step.Page, step.Trace)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var gTraceReportTemplate = template.Must(template.New("trace").Parse(TRACE_REPORT_TEMPLATE))
+
+// find the longest prefix of reg which matches data. The regex is cut where the prefix compiles,
+// but not before a quantifier, so that .+? is not traced as the greedy .+
+func TraceRegex(reg *regexp.Regexp, data []byte) (trace RegexTrace) {
+	regStr := reg.String()
+	trace.Regex = regStr
+	for end := 1; end <= len(regStr); end++ {
+		if end < len(regStr) && (!utf8.RuneStart(regStr[end]) || strings.IndexByte("*+?{", regStr[end]) >= 0) {
+			continue
+		}
+		prefixReg, err := regexp.Compile(regStr[:end])
+		if nil != err {
+			continue
+		}
+		loc := prefixReg.FindIndex(data)
+		if nil == loc {
+			break
+		}
+		trace.MatchedLen, trace.MatchStart, trace.MatchEnd = end, loc[0], loc[1]
+	}
+	return
+}
+
+// split data into the unmatched, matched and the rest parts of trace
+func TraceSegments(trace RegexTrace, data []byte) []TraceSegment {
+	return []TraceSegment{
+		TraceSegment{Text: string(data[:trace.MatchStart])},
+		TraceSegment{Text: string(data[trace.MatchStart:trace.MatchEnd]), Class: TRACE_CLASS_MATCHED},
+		TraceSegment{Class: TRACE_CLASS_BREAK, ID: TRACE_CLASS_BREAK},
+		TraceSegment{Text: string(data[trace.MatchEnd:])},
+	}
+}
+
+// split data into the parts extracted by {filter} of filterReg and the others
+func FilterSegments(filterReg *regexp.Regexp, data []byte) (segments []TraceSegment) {
+	filterInd := filterReg.SubexpIndex(PATTERN_FILTER)
+	last := 0
+	for _, loc := range filterReg.FindAllSubmatchIndex(data, -1) {
+		if 0 > filterInd || 0 > loc[2*filterInd] {
+			continue
+		}
+		start, end := loc[2*filterInd], loc[2*filterInd+1]
+		segments = append(segments, TraceSegment{Text: string(data[last:start])}, TraceSegment{Text: string(data[start:end]), Class: TRACE_CLASS_FILTERED})
+		last = end
+	}
+	return append(segments, TraceSegment{Text: string(data[last:])})
+}
+
+// write html trace report of reg which did not match pageData. If filterReg is not nil,
+// filtered is the data left by it, which reg is matched against.
+func WriteTraceReport(page string, reg, filterReg *regexp.Regexp, pageData, filtered []byte) (path string, err error) {
+	report := TraceReport{Page: page, Date: time.Now().Format(time.RFC3339)}
+	tracedData := pageData
+	if nil != filterReg {
+		tracedData = filtered
+	}
+
+	trace := TraceRegex(reg, tracedData)
+	report.BreakPos = trace.MatchEnd
+	report.Regex = []TraceSegment{
+		TraceSegment{Text: trace.Regex[:trace.MatchedLen], Class: TRACE_CLASS_MATCHED},
+		TraceSegment{Text: trace.Regex[trace.MatchedLen:], Class: TRACE_CLASS_UNMATCHED},
+	}
+	if nil == filterReg {
+		report.PageData = TraceSegments(trace, tracedData)
+	} else {
+		report.FilterRegex = filterReg.String()
+		report.FilteredData = TraceSegments(trace, tracedData)
+		report.PageData = FilterSegments(filterReg, pageData)
+	}
+
+	if err = os.MkdirAll(*gTraceDir, 0755); nil != err {
+		return
+	}
+	hash := fmt.Sprintf("%x", sha1.Sum([]byte(page+reg.String())))
+	path = filepath.Join(*gTraceDir, "trace_"+time.Now().Format("20060102_150405")+"_"+hash[:8]+".html")
+	traceFile, err := os.Create(path)
+	if nil != err {
+		return
+	}
+	defer traceFile.Close()
+
+	err = gTraceReportTemplate.Execute(traceFile, report)
+	return
+}
+
+// write trace report in debug mode, see WriteTraceReport
+func TraceFailedRegex(page string, reg, filterReg *regexp.Regexp, pageData, filtered []byte) {
+	if !*gDebug {
+		return
+	}
+	path, err := WriteTraceReport(page, reg, filterReg, pageData, filtered)
+	if nil != err {
+		log.Printf("[ERROR] failed to write trace report of %s: %s", page, err)
+		return
+	}
+	log.Printf("[DEBUG] trace report of regex %s on %s is written to %s", reg.String(), page, path)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var gUIPageTemplate = template.Must(template.New("ui").Parse(UI_PAGE))
+
+// gofeed ui, serve the web ui for building and previewing targets
+func RunUICommand(args []string) (ok bool) {
+	cmd := flag.NewFlagSet(CMD_UI, flag.ExitOnError)
+	addr := cmd.String("addr", UI_DEFAULT_ADDR, "address the web ui listens on")
+	cacheDB := cmd.String("cache", DB_NAME, "path of the cache database where the fetched pages are cached")
+	cmd.Usage = func() {
+		fmt.Printf("Usage %s ui [-addr address][-cache cache_db]\n\n", os.Args[0])
+		fmt.Printf("Flags:\n")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+
+	if 0 != cmd.NArg() {
+		cmd.Usage()
+		return false
+	}
+	conf := &Config{CacheDB: *cacheDB}
+	if err := CheckConfig(conf); nil != err {
+		log.Printf("[ERROR] %s", err)
+		return false
+	}
+	if err := InitCacheDB(conf.CacheDB, ExtractCacheLifetime(conf.CacheLifetime)); nil != err {
+		log.Printf("[ERROR] failed to create cache database %s", conf.CacheDB)
+		return false
+	}
+
+	log.Printf("gofeed ui is running at http://%s", *addr)
+	if err := http.ListenAndServe(*addr, NewUIHandler(conf, *addr)); nil != err {
+		log.Printf("[ERROR] failed to serve web ui at %s: %s", *addr, err)
+		return false
+	}
+	return true
+}
+
+// handler of the web ui listening on addr, pages are cached in conf.CacheDB
+func NewUIHandler(conf *Config, addr string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if "/" != r.URL.Path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		gUIPageTemplate.Execute(w, struct{ PreviewDelay int }{UI_PREVIEW_DELAY})
+	})
+	mux.HandleFunc("/fetch", func(w http.ResponseWriter, r *http.Request) {
+		if req := ReadUIRequest(w, r); nil != req {
+			WriteUIResponse(w, UIFetch(conf, req))
+		}
+	})
+	mux.HandleFunc("/preview", func(w http.ResponseWriter, r *http.Request) {
+		if req := ReadUIRequest(w, r); nil != req {
+			WriteUIResponse(w, UIPreview(conf, req))
+		}
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := CheckUIRequestOrigin(r, addr); nil != err {
+			log.Printf("[WARN] web ui request from %s rejected: %s", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// other sites may reach the web ui through the browser with cross-site posts or dns rebinding.
+// Host should be addr or a loopback name, and Origin should be the web ui itself if sent.
+func CheckUIRequestOrigin(r *http.Request, addr string) error {
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); nil == err {
+		host = hostname
+	}
+	if addr != r.Host && !IsLoopbackHost(strings.Trim(host, "[]")) {
+		return fmt.Errorf("host %s is not allowed", r.Host)
+	}
+	if origin := r.Header.Get("Origin"); "" != origin {
+		if originURL, err := url.Parse(origin); nil != err || r.Host != originURL.Host {
+			return fmt.Errorf("origin %s is not allowed", origin)
+		}
+	}
+	return nil
+}
+
+func IsLoopbackHost(host string) bool {
+	if "localhost" == strings.ToLower(host) {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return nil != ip && ip.IsLoopback()
+}
+
+// decode json request, nil is returned if the error has been written to w
+func ReadUIRequest(w http.ResponseWriter, r *http.Request) (req *UIRequest) {
+	if http.MethodPost != r.Method {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return nil
+	}
+	// json requests cannot be sent by other sites without cors
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); nil != err || "application/json" != mediaType {
+		http.Error(w, "Content-Type should be application/json", http.StatusUnsupportedMediaType)
+		return nil
+	}
+	req = new(UIRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); nil != err {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	return
+}
+
+func WriteUIResponse(w http.ResponseWriter, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(resp); nil != err {
+		log.Printf("[ERROR] failed to write web ui response: %s", err)
+	}
+}
+
+// download req.URL, or read it from the cache database, and return the minified html
+func UIFetch(conf *Config, req *UIRequest) (resp UIFetchResponse) {
+	pageURL, err := url.Parse(NormalizeURLStr(req.URL))
+	if nil != err || !pageURL.IsAbs() {
+		resp.Error = "invalid url " + req.URL
+		return
+	}
+	htmlData, err := LoadTestPage(NewFetchTarget(conf), pageURL, "")
+	if nil != err {
+		resp.Error = err.Error()
+		return
+	}
+	resp.Html = string(htmlData)
+	return
+}
+
+// run the patterns of req like gofeed test, and export them as json config
+func UIPreview(conf *Config, req *UIRequest) (resp UIPreviewResponse) {
+	tar := UITargetConfig(req)
+	resp.Config = ExportTargetConfig(tar)
+	for _, issue := range append(LintPatterns(tar), LintContentRules(tar)...) {
+		resp.Issues = append(resp.Issues, issue.String())
+	}
+
+	feedTar, err := BuildFeedTarget(conf, tar)
+	if nil != err {
+		resp.Error = err.Error()
+		return
+	}
+	// previews run on every edit, trace reports are only written in debug mode
+	feed, steps := RunTargetTest(feedTar, "", "", TEST_MAX_ENTRIES, *gDebug)
+	resp.Steps = steps
+	for _, entry := range feed.Entries {
+		uiEntry := UIEntry{Title: entry.Title, Description: TruncateString(string(entry.Content), UI_DESCRIPTION_WIDTH)}
+		if nil != entry.Link {
+			uiEntry.Link = entry.Link.String()
+		}
+		if nil != entry.PubDate {
+			uiEntry.PubDate = entry.PubDate.Format("2006-01-02 15:04:05")
+		}
+		resp.Entries = append(resp.Entries, uiEntry)
+	}
+	return
+}
+
+// target config of the non-empty fields of req
+func UITargetConfig(req *UIRequest) *TargetConfig {
+	tar := &TargetConfig{Title: req.Title, FeedPath: req.Path}
+	for _, opt := range []struct {
+		value string
+		pats  *[]string
+	}{
+		{req.URL, &tar.URLs},
+		{req.IndexFilterPattern, &tar.IndexFilterPatterns},
+		{req.IndexPattern, &tar.IndexPatterns},
+		{req.ContentFilterPattern, &tar.ContentFilterPatterns},
+		{req.ContentPattern, &tar.ContentPatterns},
+		{req.PubDatePattern, &tar.PubDatePatterns},
+	} {
+		if "" != opt.value {
+			*opt.pats = []string{opt.value}
+		}
+	}
+	return tar
+}
+
+// json of the fields of tar which are edited in the web ui or guessed by gofeed init,
+// empty ones are omitted
+func ExportTargetConfig(tar *TargetConfig) string {
+	block := make(map[string]interface{})
+	for key, value := range map[string]string{"Feed.Title": tar.Title, "Feed.Path": tar.FeedPath, "Feed.Mode": tar.Mode,
+		"Feed.ContentFallback": tar.ContentFallback} {
+		if "" != value {
+			block[key] = value
+		}
+	}
+	for key, pats := range map[string][]string{
+		"Feed.URL":                  tar.URLs,
+		"Feed.IndexFilterPattern":   tar.IndexFilterPatterns,
+		"Feed.IndexPattern":         tar.IndexPatterns,
+		"Feed.ContentFilterPattern": tar.ContentFilterPatterns,
+		"Feed.ContentPattern":       tar.ContentPatterns,
+		"Feed.PubDatePattern":       tar.PubDatePatterns,
+	} {
+		if 0 != len(pats) {
+			block[key] = pats
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	enc.Encode(block)
+	return buf.String()
+}
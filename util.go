@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"errors"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
@@ -41,16 +44,46 @@ func NormalizeURLStr(rawString string) string {
 	return rawString
 }
 
+// return the Feed.URL which the index page comes from, next index pages share
+// the patterns of their Feed.URL
+func FindTargetURL(feedTar *FeedTarget, pageURL *url.URL) *url.URL {
+	if origin, ok := feedTar.IndexPageOrigins[pageURL]; ok {
+		return origin
+	}
+	return pageURL
+}
+
+// index of the Feed.URL which the index page comes from, -1 if not found. Urls expanded from
+// the same url template share the patterns of their Feed.URL
+func FindTargetURLIndex(feedTar *FeedTarget, pageURL *url.URL) int {
+	pageURL = FindTargetURL(feedTar, pageURL)
+	if urlInd, ok := feedTar.URLIndexes[pageURL]; ok {
+		return urlInd
+	}
+	for i := 0; i < len(feedTar.URLs); i++ {
+		if feedTar.URLs[i] == pageURL {
+			return i
+		}
+	}
+	return -1
+}
+
+// number of Feed.URL which the patterns are defined for
+func TargetURLNum(feedTar *FeedTarget) int {
+	if 0 == feedTar.URLNum {
+		return len(feedTar.URLs)
+	}
+	return feedTar.URLNum
+}
+
 // FeedTarget should be generated by ParseJsonConfig function
-// find index regexp
+// find index regexp of the index page, all of them if they are shared by the urls
 func FindIndexRegs(feedTar *FeedTarget, feedURL *url.URL) []*regexp.Regexp {
-	if 1 == len(feedTar.URLs) || 1 == len(feedTar.IndexRegs) {
+	if 1 == TargetURLNum(feedTar) || 1 == len(feedTar.IndexRegs) {
 		return feedTar.IndexRegs
 	}
-	for i := 0; i < len(feedTar.URLs); i++ {
-		if feedTar.URLs[i] == feedURL {
-			return []*regexp.Regexp{feedTar.IndexRegs[i]}
-		}
+	if urlInd := FindTargetURLIndex(feedTar, feedURL); 0 <= urlInd && urlInd < len(feedTar.IndexRegs) {
+		return []*regexp.Regexp{feedTar.IndexRegs[urlInd]}
 	}
 	return nil
 }
@@ -58,22 +91,30 @@ func FindIndexRegs(feedTar *FeedTarget, feedURL *url.URL) []*regexp.Regexp {
 // FeedTarget should be generated by ParseJsonConfig function
 // find content regexp
 func FindContentReg(feedTar *FeedTarget, feedURL *url.URL, indexReg *regexp.Regexp) *regexp.Regexp {
+	// content patterns are optional for gofeed test
+	if 0 == len(feedTar.ContentRegs) {
+		return nil
+	}
+
+	// entries extracted without index regex(xpath for example) share the only content regex
+	if 1 == len(feedTar.ContentRegs) {
+		return feedTar.ContentRegs[0]
+	}
+
 	if nil == indexReg {
 		return nil
 	}
 
-	urlNum := len(feedTar.URLs)
+	urlNum := TargetURLNum(feedTar)
 	indNum := len(feedTar.IndexRegs)
 
-	if 1 == len(feedTar.ContentRegs) || (1 == urlNum && 1 == indNum) {
+	if 1 == urlNum && 1 == indNum {
 		return feedTar.ContentRegs[0]
 	}
 
 	if 1 == indNum && 1 != urlNum {
-		for i := 0; i < urlNum; i++ {
-			if feedTar.URLs[i] == feedURL {
-				return feedTar.ContentRegs[i]
-			}
+		if urlInd := FindTargetURLIndex(feedTar, feedURL); 0 <= urlInd && urlInd < len(feedTar.ContentRegs) {
+			return feedTar.ContentRegs[urlInd]
 		}
 	} else {
 		for i := 0; i < indNum; i++ {
@@ -150,10 +191,8 @@ func FindPubDateReg(feedTar *FeedTarget, feedURL *url.URL) *regexp.Regexp {
 	} else if 1 == pubDateNum {
 		return feedTar.PubDateRegs[0]
 	}
-	for i := 0; i < len(feedTar.URLs); i++ {
-		if feedTar.URLs[i] == feedURL {
-			return feedTar.PubDateRegs[i]
-		}
+	if urlInd := FindTargetURLIndex(feedTar, feedURL); 0 <= urlInd && urlInd < pubDateNum {
+		return feedTar.PubDateRegs[urlInd]
 	}
 	return nil
 }
@@ -239,24 +278,41 @@ func ParsePubDate(formatReg *regexp.Regexp, dateStr string) (time.Time, error) {
 	return time.Date(year, time.Month(month), day, hour, minute, second, 0, GOFEED_DEFAULT_TIMEZONE), nil
 }
 
+// parse time string in STANDARD_TIME_LAYOUTS, or unix timestamp in seconds or milliseconds
+func ParseStandardTime(timeStr string) (time.Time, error) {
+	timeStr = strings.TrimSpace(timeStr)
+	if timestamp, err := strconv.ParseInt(timeStr, 10, 64); nil == err {
+		if UNIX_MILLI_TIMESTAMP_MIN <= timestamp {
+			return time.Unix(timestamp/1000, timestamp%1000*int64(time.Millisecond)).In(GOFEED_DEFAULT_TIMEZONE), nil
+		}
+		return time.Unix(timestamp, 0).In(GOFEED_DEFAULT_TIMEZONE), nil
+	}
+	for _, layout := range STANDARD_TIME_LAYOUTS {
+		if t, err := time.ParseInLocation(layout, timeStr, GOFEED_DEFAULT_TIMEZONE); nil == err {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("unknown time format " + timeStr)
+}
+
 func RemoveDuplicatEntries(feed *Feed) bool {
 	if nil == feed {
 		return false
 	}
 
 	entryMap := make(map[string]bool)
-	newEntries := make([]*FeedEntry, 1)
-	newEntryInd := 0
+	// starts empty, so that no entries leaves no nil entry
+	newEntries := make([]*FeedEntry, 0, len(feed.Entries))
 
 	for _, entry := range feed.Entries {
-		if nil == entry.Link {
+		if nil == entry || nil == entry.Link {
 			continue
 		}
 		link := entry.Link.String()
 		if !entryMap[link] {
 			entryMap[link] = true
-			newEntries = append(newEntries[:newEntryInd], entry)
-			newEntryInd += 1
+			newEntries = append(newEntries, entry)
 		} else {
 			log.Printf("[WARN] removed duplicate feed entry %s", entry.Link.String())
 		}
@@ -323,3 +379,35 @@ func GenPDPRegexStr(pdp string, nonEmpty bool, nonGreedy bool) string {
 
 	return regStr + `)`
 }
+
+// decompress data if it is gzip compressed, such as sitemap.xml.gz
+func GunzipData(data []byte) ([]byte, error) {
+	if 2 > len(data) || 0x1f != data[0] || 0x8b != data[1] {
+		return data, nil
+	}
+
+	gzipR, err := gzip.NewReader(bytes.NewReader(data))
+	if nil != err {
+		return nil, err
+	}
+	defer gzipR.Close()
+	return ioutil.ReadAll(gzipR)
+}
+
+func StringInSlice(str string, strs []string) bool {
+	for _, s := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate str to at most width runes, "..." is appended if truncated
+func TruncateString(str string, width int) string {
+	runes := []rune(str)
+	if len(runes) <= width {
+		return str
+	}
+	return string(runes[:width-3]) + "..."
+}
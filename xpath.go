@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+	"log"
+	"net/url"
+	"strings"
+)
+
+func CompileXPath(expr string) (*xpath.Expr, error) {
+	if "" == strings.TrimSpace(expr) {
+		return nil, nil
+	}
+	return xpath.Compile(expr)
+}
+
+func CompileXPathRule(ruleConf *ExtractRuleConfig) (rule *XPathRule, err error) {
+	if nil == ruleConf {
+		return
+	}
+
+	rule = new(XPathRule)
+	exprs := []struct {
+		expr    string
+		compExp **xpath.Expr
+	}{
+		{ruleConf.Entry, &rule.Entry},
+		{ruleConf.Title, &rule.Title},
+		{ruleConf.Link, &rule.Link},
+		{ruleConf.Description, &rule.Description},
+		{ruleConf.PubDate, &rule.PubDate},
+	}
+	for _, e := range exprs {
+		*e.compExp, err = CompileXPath(e.expr)
+		if nil != err {
+			log.Printf("[ERROR] error compiling xpath %s: %s", e.expr, err)
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// description is the inner html of the selected node, other fields are inner text
+func XPathSelectField(top *html.Node, expr *xpath.Expr, fieldName string) (value []byte, err error) {
+	node := htmlquery.QuerySelector(top, expr)
+	if nil == node {
+		return nil, errors.New("xpath " + expr.String() + " selected nothing")
+	}
+
+	if PATTERN_CONTENT == fieldName {
+		return []byte(htmlquery.OutputHTML(node, false)), nil
+	}
+	return []byte(strings.TrimSpace(htmlquery.InnerText(node))), nil
+}
+
+// extract entries with Feed.IndexXPath and Feed.ContentXPath
+type XPathExtractor struct {
+	feedTar *FeedTarget
+}
+
+func NewXPathExtractor(feedTar *FeedTarget, tar *TargetConfig) (Extractor, error) {
+	return &XPathExtractor{feedTar: feedTar}, nil
+}
+
+func (ext *XPathExtractor) ExtractIndex(feed *Feed, tarURL *url.URL, htmlData []byte) (entries []*FeedEntry, err error) {
+	feedTar := ext.feedTar
+	rule := feedTar.IndexXPath
+	if nil == rule {
+		return nil, errors.New("Feed.IndexXPath not defined")
+	}
+	doc, err := ParseHtmlDom(htmlData)
+	if nil != err {
+		return
+	}
+
+	entryNodes := htmlquery.QuerySelectorAll(doc, rule.Entry)
+	if 0 == len(entryNodes) {
+		return nil, errors.New("xpath " + rule.Entry.String() + " selected nothing")
+	}
+
+	fields := []struct {
+		expr *xpath.Expr
+		name string
+	}{
+		{rule.Title, PATTERN_TITLE},
+		{rule.Link, PATTERN_LINK},
+		{rule.Description, PATTERN_CONTENT},
+		{rule.PubDate, PATTERN_PUBDATE},
+	}
+	for _, entryNode := range entryNodes {
+		entry := new(FeedEntry)
+		for _, field := range fields {
+			if nil == field.expr {
+				continue
+			}
+			value, err := XPathSelectField(entryNode, field.expr, field.name)
+			if nil != err {
+				log.Printf("[WARN] failed to extract %s from index html %s: %s", field.name, tarURL.String(), err)
+				continue
+			}
+			SetEntryField(feedTar, feed, entry, tarURL, field.name, value)
+		}
+		entries = append(entries, entry)
+	}
+
+	return
+}
+
+func (ext *XPathExtractor) ExtractContent(feed *Feed, entry *FeedEntry, htmlData []byte) (fields EntryFields, err error) {
+	rule := ext.feedTar.ContentXPath
+	if nil == rule {
+		return nil, errors.New("Feed.ContentXPath not defined")
+	}
+	doc, err := ParseHtmlDom(htmlData)
+	if nil != err {
+		return
+	}
+
+	value, err := XPathSelectField(doc, rule.Description, PATTERN_CONTENT)
+	if nil != err {
+		return
+	}
+	fields = EntryFields{PATTERN_CONTENT: value}
+
+	if nil != rule.PubDate {
+		value, err = XPathSelectField(doc, rule.PubDate, PATTERN_PUBDATE)
+		if nil != err {
+			log.Printf("[WARN] failed to extract pubdate from content html %s: %s", entry.Link, err)
+		} else {
+			fields[PATTERN_PUBDATE] = value
+		}
+	}
+
+	return fields, nil
+}